@@ -0,0 +1,315 @@
+package state_machine
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Audit outcomes
+const (
+	AuditOutcomeSuccess    = "success"
+	AuditOutcomeRejected   = "rejected"
+	AuditOutcomeFailed     = "failed"
+	AuditOutcomeNotAllowed = "not_allowed"
+	AuditOutcomeCanceled   = "canceled"
+)
+
+// AuditSink receives a record for each transition attempt.
+// A sink must be safe for concurrent use and handle its own failures,
+// they never change the outcome of the transition.
+type AuditSink interface {
+	Record(ctx context.Context, record AuditRecord)
+}
+
+// AuditParent the transition that triggered a nested transition
+type AuditParent struct {
+	// Machine
+	Machine string `json:"machine"`
+	// From
+	From string `json:"from"`
+	// To
+	To string `json:"to"`
+}
+
+// AuditRecord a transition attempt
+type AuditRecord struct {
+	// Machine
+	Machine string `json:"machine"`
+	// ObjectId identifies the object, see WithAuditObjectId
+	ObjectId string `json:"object_id,omitempty"`
+	// From state, empty on the initial transition
+	From string `json:"from"`
+	// To state
+	To string `json:"to"`
+	// Event that fired the transition
+	Event string `json:"event,omitempty"`
+	// Outcome
+	Outcome string `json:"outcome"`
+	// Stage where the attempt failed (check, execute, on_success, ...)
+	Stage string `json:"stage,omitempty"`
+	// Handler that failed
+	Handler string `json:"handler,omitempty"`
+	// Error message
+	Error string `json:"error,omitempty"`
+	// StartedAt
+	StartedAt time.Time `json:"started_at"`
+	// Duration
+	Duration time.Duration `json:"duration"`
+	// Parent transition when triggered by another state machine
+	Parent *AuditParent `json:"parent,omitempty"`
+	// Object
+	Object any `json:"-"`
+	// Err
+	Err error `json:"-"`
+}
+
+// AuditQuery filters audit records, empty fields match every record
+type AuditQuery struct {
+	// Machine
+	Machine string
+	// ObjectId
+	ObjectId string
+	// From
+	From string
+	// To
+	To string
+	// Event
+	Event string
+	// Outcome
+	Outcome string
+	// Handler
+	Handler string
+	// Parent machine
+	ParentMachine string
+}
+
+// Match checks if the record matches the query
+func (q AuditQuery) Match(record AuditRecord) bool {
+	var parentMachine string
+	if record.Parent != nil {
+		parentMachine = record.Parent.Machine
+	}
+
+	return matchAuditField(q.Machine, record.Machine) &&
+		matchAuditField(q.ObjectId, record.ObjectId) &&
+		matchAuditField(q.From, record.From) &&
+		matchAuditField(q.To, record.To) &&
+		matchAuditField(q.Event, record.Event) &&
+		matchAuditField(q.Outcome, record.Outcome) &&
+		matchAuditField(q.Handler, record.Handler) &&
+		matchAuditField(q.ParentMachine, parentMachine)
+}
+
+func matchAuditField(query, value string) bool {
+	return query == "" || query == value
+}
+
+// QueryAuditRecords returns the records matching the query
+func QueryAuditRecords(records []AuditRecord, query AuditQuery) (result []AuditRecord) {
+	for _, record := range records {
+		if query.Match(record) {
+			result = append(result, record)
+		}
+	}
+
+	return result
+}
+
+// ReadAuditRecords reads the records written by a FileAuditSink
+func ReadAuditRecords(reader io.Reader) (records []AuditRecord, err error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record AuditRecord
+		if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, scanner.Err()
+}
+
+// AddAuditSink adds a sink that receives a record for each transition attempt
+func (sm *StateMachine) AddAuditSink(sink AuditSink) {
+	sm.register(func() {
+		sm.auditSinks = append(sm.auditSinks, sink)
+	})
+}
+
+// WithAuditSink adds a sink that receives a record for each transition attempt
+func WithAuditSink(sink AuditSink) Option {
+	return func(sm *StateMachine) {
+		sm.auditSinks = append(sm.auditSinks, sink)
+	}
+}
+
+// WithAuditObjectId sets the function that identifies the objects in the audit records,
+// the one of the state store by default
+func WithAuditObjectId(objectId func(obj any) string) Option {
+	return func(sm *StateMachine) {
+		sm.auditObjectId = objectId
+	}
+}
+
+// audit sends the record of the transition run to the sinks
+func (sm *StateMachine) audit(ctx context.Context, run *transitionRun, success bool, err error) {
+	sm.mux.RLock()
+	sinks, objectId := sm.auditSinks, sm.auditObjectId
+	if objectId == nil {
+		objectId = sm.stateStoreObjectId
+	}
+	sm.mux.RUnlock()
+
+	if len(sinks) == 0 {
+		return
+	}
+
+	record := AuditRecord{
+		Machine:   run.machine,
+		From:      run.from,
+		To:        run.to,
+		Event:     run.event,
+		Stage:     run.failedStage,
+		Handler:   run.failedHandler,
+		StartedAt: run.startedAt,
+		Duration:  time.Since(run.startedAt),
+		Parent:    run.parent,
+		Object:    run.obj,
+		Err:       err,
+	}
+
+	if objectId != nil {
+		record.ObjectId = objectId(run.obj)
+	}
+
+	if record.Err == nil {
+		record.Err = run.err
+	}
+
+	if record.Err != nil {
+		record.Error = record.Err.Error()
+	}
+
+	var canceled *ErrTransitionCanceled
+	switch {
+	case errors.As(err, &canceled):
+		record.Outcome = AuditOutcomeCanceled
+	case run.notAllowed:
+		record.Outcome = AuditOutcomeNotAllowed
+	case run.failedStage == transitionStageCheck:
+		record.Outcome = AuditOutcomeRejected
+	case run.failedStage != "" || err != nil:
+		record.Outcome = AuditOutcomeFailed
+	case !success:
+		record.Outcome = AuditOutcomeRejected
+	default:
+		record.Outcome = AuditOutcomeSuccess
+	}
+
+	for _, sink := range sinks {
+		sink.Record(ctx, record)
+	}
+}
+
+// MemoryAuditSink keeps the audit records in memory
+type MemoryAuditSink struct {
+	mux     sync.RWMutex
+	records []AuditRecord
+}
+
+// NewMemoryAuditSink creates a new in memory audit sink
+func NewMemoryAuditSink() *MemoryAuditSink {
+	return &MemoryAuditSink{}
+}
+
+func (s *MemoryAuditSink) Record(_ context.Context, record AuditRecord) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.records = append(s.records, record)
+}
+
+// Records returns every record in the order they were received
+func (s *MemoryAuditSink) Records() []AuditRecord {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return append([]AuditRecord(nil), s.records...)
+}
+
+// Query returns the records matching the query
+func (s *MemoryAuditSink) Query(query AuditQuery) []AuditRecord {
+	return QueryAuditRecords(s.Records(), query)
+}
+
+// Reset removes every record
+func (s *MemoryAuditSink) Reset() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.records = nil
+}
+
+// FileAuditSink writes the audit records as JSON lines
+type FileAuditSink struct {
+	mux     sync.Mutex
+	encoder *json.Encoder
+	closer  io.Closer
+	err     error
+}
+
+// NewFileAuditSink creates an audit sink that appends the records to a file
+func NewFileAuditSink(filePath string) (*FileAuditSink, error) {
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	sink := NewWriterAuditSink(file)
+	sink.closer = file
+
+	return sink, nil
+}
+
+// NewWriterAuditSink creates an audit sink that writes the records to a writer
+func NewWriterAuditSink(writer io.Writer) *FileAuditSink {
+	return &FileAuditSink{
+		encoder: json.NewEncoder(writer),
+	}
+}
+
+func (s *FileAuditSink) Record(_ context.Context, record AuditRecord) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if err := s.encoder.Encode(record); err != nil && s.err == nil {
+		s.err = err
+	}
+}
+
+// Err returns the first error while writing the records
+func (s *FileAuditSink) Err() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.err
+}
+
+// Close closes the file of the sink
+func (s *FileAuditSink) Close() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.closer == nil {
+		return nil
+	}
+
+	return s.closer.Close()
+}
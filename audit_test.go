@@ -0,0 +1,133 @@
+package state_machine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestQueryAuditRecords(t *testing.T) {
+	records := []AuditRecord{
+		{Machine: "orders", ObjectId: "1", From: "pending", To: "paid", Outcome: AuditOutcomeSuccess},
+		{Machine: "orders", ObjectId: "2", From: "pending", To: "paid", Outcome: AuditOutcomeRejected, Handler: "isPaid"},
+		{Machine: "invoices", ObjectId: "1", From: "draft", To: "sent", Outcome: AuditOutcomeSuccess, Parent: &AuditParent{Machine: "orders"}},
+	}
+
+	tests := []struct {
+		name  string
+		query AuditQuery
+		want  []int
+	}{
+		{name: "empty query matches every record", query: AuditQuery{}, want: []int{0, 1, 2}},
+		{name: "by machine", query: AuditQuery{Machine: "orders"}, want: []int{0, 1}},
+		{name: "by object and outcome", query: AuditQuery{ObjectId: "1", Outcome: AuditOutcomeSuccess}, want: []int{0, 2}},
+		{name: "by handler", query: AuditQuery{Handler: "isPaid"}, want: []int{1}},
+		{name: "by parent machine", query: AuditQuery{ParentMachine: "orders"}, want: []int{2}},
+		{name: "without matches", query: AuditQuery{Machine: "orders", To: "sent"}, want: nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var want []AuditRecord
+			for _, index := range test.want {
+				want = append(want, records[index])
+			}
+
+			if got := QueryAuditRecords(records, test.query); !reflect.DeepEqual(got, want) {
+				t.Errorf("QueryAuditRecords = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestFileAuditSink(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := NewFileAuditSink(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := "pending"
+	sm := NewStateMachine(WithAuditSink(sink), WithAuditObjectId(func(obj any) string { return obj.(string) }))
+	if err = sm.LoadFromBytes([]byte(`{"name":"orders","states":[
+		{"name":"pending","initial":true,"transitions":[{"name":"paid","check":[{"func":"isPaid"}]}]},
+		{"name":"paid","final":true}]}`), "json"); err != nil {
+		t.Fatal(err)
+	}
+	sm.AddCurrentStateFunction(func(any) (string, error) { return state, nil })
+	sm.AddExecuteFunction(func(nextState string, _ any) error {
+		state = nextState
+		return nil
+	})
+	paid := false
+	sm.AddCheckFunction("isPaid", func(any, ...string) (bool, error) { return paid, nil })
+
+	_, _ = sm.ProcessTransition("paid", "order-1")
+	paid = true
+	_, _ = sm.ProcessTransition("paid", "order-1")
+	_, _ = sm.ProcessTransition("pending", "order-1")
+
+	if err = sink.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	records, err := ReadAuditRecords(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		outcome string
+		from    string
+		to      string
+		err     bool
+	}{
+		{outcome: AuditOutcomeRejected, from: "pending", to: "paid", err: true},
+		{outcome: AuditOutcomeSuccess, from: "pending", to: "paid"},
+		{outcome: AuditOutcomeNotAllowed, from: "paid", to: "pending", err: true},
+	}
+
+	if len(records) != len(tests) {
+		t.Fatalf("records = %v, want %d records", records, len(tests))
+	}
+	for i, test := range tests {
+		record := records[i]
+		if record.Machine != "orders" || record.ObjectId != "order-1" || record.From != test.from || record.To != test.to || record.Outcome != test.outcome {
+			t.Errorf("record %d = %+v, want %s from [%s] to [%s]", i, record, test.outcome, test.from, test.to)
+		}
+		if (record.Error != "") != test.err {
+			t.Errorf("record %d error = %q, want error %v", i, record.Error, test.err)
+		}
+	}
+
+	if got := QueryAuditRecords(records, AuditQuery{Outcome: AuditOutcomeSuccess}); len(got) != 1 {
+		t.Errorf("successful records = %v, want 1", got)
+	}
+}
+
+func TestFileAuditSinkErr(t *testing.T) {
+	sink := NewWriterAuditSink(failingWriter{})
+	sink.Record(context.Background(), AuditRecord{Machine: "orders"})
+
+	if err := sink.Err(); err == nil {
+		t.Error("Err() = nil, want the write error")
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
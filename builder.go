@@ -0,0 +1,601 @@
+package state_machine
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	builderHandlerCheck      = "check"
+	builderHandlerOnSuccess  = "on_success"
+	builderHandlerOnError    = "on_error"
+	builderHandlerOnEnter    = "on_enter"
+	builderHandlerOnExit     = "on_exit"
+	builderHandlerBefore     = "before_transition"
+	builderHandlerAfter      = "after_transition"
+	builderHandlerCompensate = "compensate"
+	// builderNoTransition no transition is selected
+	builderNoTransition = -1
+	// builderCreateTransition selects the create transition of the initial state
+	builderCreateTransition = -2
+)
+
+// Builder defines a state machine in code, producing the same structures as a loaded definition
+//
+//	sm, err := NewBuilder("orders").
+//		State("new").Initial().
+//		Transition("paid").Check("auth", "ADMIN").OnSuccess("notify").
+//		State("paid").Final().
+//		Build()
+//
+// The functions bound with CheckFunc, OnSuccessFunc, OnErrorFunc and CompensateFunc are registered under generated
+// names (check#1, on_success#2, ...) that MarshalDefinition writes as they are. A definition serialized by the built
+// state machine only loads with the same functions registered under those names, so bind the functions by name
+// (Check, OnSuccess, ...) for a definition meant to be serialized and loaded again.
+type Builder struct {
+	definition   Definition
+	opts         []Option
+	region       int
+	state        int
+	transition   int
+	lastHandler  string
+	lastIndex    int
+	execute      HandlerExecFunctionContext
+	currentState CurrentStateFuncContext
+	checks       map[string]HandlerFuncContext
+	onSuccess    map[string]HandlerFuncContext
+	onError      map[string]HandlerFuncContext
+	compensate   map[string]HandlerFuncContext
+	triggers     map[string]IStateMachine
+	funcs        int
+	err          error
+}
+
+// NewBuilder creates a builder of a state machine with the given name
+func NewBuilder(name string, opts ...Option) *Builder {
+	return &Builder{
+		definition: Definition{Name: name},
+		opts:       opts,
+		region:     -1,
+		state:      -1,
+		transition: builderNoTransition,
+		checks:     make(map[string]HandlerFuncContext),
+		onSuccess:  make(map[string]HandlerFuncContext),
+		onError:    make(map[string]HandlerFuncContext),
+		compensate: make(map[string]HandlerFuncContext),
+		triggers:   make(map[string]IStateMachine),
+	}
+}
+
+// State declares a state in the selected region, or selects it when already declared
+func (b *Builder) State(name string) *Builder {
+	b.lastHandler = ""
+	states := b.states()
+	for i, state := range *states {
+		if state.Name == name {
+			b.state = i
+			b.transition = len(state.Transitions) - 1
+			return b
+		}
+	}
+
+	*states = append(*states, StateInput{Name: name})
+	b.state = len(*states) - 1
+	b.transition = builderNoTransition
+
+	return b
+}
+
+// Region declares an orthogonal region, or selects it when already declared, the next states are declared in it.
+// Region(MainRegion) selects the main region back.
+func (b *Builder) Region(name string) *Builder {
+	b.state, b.transition, b.lastHandler = -1, builderNoTransition, ""
+	b.region = -1
+	if name == MainRegion {
+		return b
+	}
+
+	for i, region := range b.definition.Regions {
+		if region.Name == name {
+			b.region = i
+			return b
+		}
+	}
+
+	b.definition.Regions = append(b.definition.Regions, RegionInput{Name: name})
+	b.region = len(b.definition.Regions) - 1
+
+	return b
+}
+
+// states returns the states of the selected region
+func (b *Builder) states() *[]StateInput {
+	if b.region < 0 {
+		return &b.definition.States
+	}
+
+	return &b.definition.Regions[b.region].States
+}
+
+// Initial marks the selected state as the initial state
+func (b *Builder) Initial() *Builder {
+	if state := b.currentStateInput("Initial"); state != nil {
+		state.Initial = true
+	}
+
+	return b
+}
+
+// Final marks the selected state as a final state
+func (b *Builder) Final() *Builder {
+	if state := b.currentStateInput("Final"); state != nil {
+		state.Final = true
+	}
+
+	return b
+}
+
+// Parent nests the selected state in a parent state, the transitions of the parent apply to its descendants
+func (b *Builder) Parent(parent string) *Builder {
+	if state := b.currentStateInput("Parent"); state != nil {
+		state.Parent = parent
+	}
+
+	return b
+}
+
+// InitialChild sets the child entered when a transition targets the selected state
+func (b *Builder) InitialChild(child string) *Builder {
+	if state := b.currentStateInput("InitialChild"); state != nil {
+		state.InitialChild = child
+	}
+
+	return b
+}
+
+// Create selects the create transition of the selected initial state
+func (b *Builder) Create() *Builder {
+	if state := b.currentStateInput("Create"); state != nil {
+		b.transition = builderCreateTransition
+		b.lastHandler = ""
+	}
+
+	return b
+}
+
+// Transition declares a transition from the selected state to the next state
+func (b *Builder) Transition(nextState string) *Builder {
+	state := b.currentStateInput("Transition")
+	if state == nil {
+		return b
+	}
+
+	state.Transitions = append(state.Transitions, TransitionInput{Name: nextState})
+	b.transition = len(state.Transitions) - 1
+	b.lastHandler = ""
+
+	return b
+}
+
+// Event names the event that fires the selected transition
+func (b *Builder) Event(event string) *Builder {
+	if transition := b.currentTransitionInput("Event"); transition != nil {
+		transition.Event = event
+	}
+
+	return b
+}
+
+// After processes the selected transition once the object spent the duration in the state, see ProcessDueTimers
+func (b *Builder) After(after time.Duration) *Builder {
+	if transition := b.currentTransitionInput("After"); transition != nil {
+		transition.After = after.String()
+	}
+
+	return b
+}
+
+// Join requires the region to be in the state for the selected transition,
+// the transition is processed once all the regions of its join reach their states
+func (b *Builder) Join(region, state string) *Builder {
+	if transition := b.currentTransitionInput("Join"); transition != nil {
+		for i := range transition.Join {
+			if transition.Join[i].Region == region {
+				transition.Join[i].State = state
+				return b
+			}
+		}
+		transition.Join = append(transition.Join, JoinInput{Region: region, State: state})
+	}
+
+	return b
+}
+
+// Guard adds a guard expression to the selected transition, the guards of a transition must all pass
+func (b *Builder) Guard(expr string) *Builder {
+	transition := b.currentTransitionInput("Guard")
+	if transition == nil {
+		return b
+	}
+
+	guard := GuardInput{Expr: expr}
+	switch {
+	case transition.Guard == nil:
+		transition.Guard = &guard
+	case len(transition.Guard.All) > 0:
+		transition.Guard.All = append(transition.Guard.All, guard)
+	default:
+		transition.Guard = &GuardInput{All: []GuardInput{*transition.Guard, guard}}
+	}
+	b.lastHandler = ""
+
+	return b
+}
+
+// Check adds a registered check function to the selected transition
+func (b *Builder) Check(name string, args ...string) *Builder {
+	if transition := b.currentTransitionInput("Check"); transition != nil {
+		transition.Check = append(transition.Check, CheckInputStruct{Func: name, FuncArg: args})
+		b.lastHandler, b.lastIndex = builderHandlerCheck, len(transition.Check)-1
+	}
+
+	return b
+}
+
+// CheckAll adds a group of checks to the selected transition that passes when all of them pass
+func (b *Builder) CheckAll(checks ...CheckInputStruct) *Builder {
+	return b.checkGroup("CheckAll", CheckInputStruct{All: checks})
+}
+
+// CheckAny adds a group of checks to the selected transition that passes when any of them passes
+func (b *Builder) CheckAny(checks ...CheckInputStruct) *Builder {
+	return b.checkGroup("CheckAny", CheckInputStruct{Any: checks})
+}
+
+// CheckNot adds a check to the selected transition that passes when the given check does not pass
+func (b *Builder) CheckNot(check CheckInputStruct) *Builder {
+	return b.checkGroup("CheckNot", CheckInputStruct{Not: &check})
+}
+
+func (b *Builder) checkGroup(method string, check CheckInputStruct) *Builder {
+	if transition := b.currentTransitionInput(method); transition != nil {
+		transition.Check = append(transition.Check, check)
+		b.lastHandler, b.lastIndex = builderHandlerCheck, len(transition.Check)-1
+	}
+
+	return b
+}
+
+// CheckFunc binds a check function to the selected transition
+func (b *Builder) CheckFunc(handler HandlerFuncContext, args ...string) *Builder {
+	name := b.funcName(builderHandlerCheck)
+	b.checks[name] = handler
+	return b.Check(name, args...)
+}
+
+// OnSuccess adds a registered on_success function to the selected transition
+func (b *Builder) OnSuccess(name string, args ...string) *Builder {
+	if transition := b.currentTransitionInput("OnSuccess"); transition != nil {
+		transition.OnSuccess = append(transition.OnSuccess, OnSuccessInputStruct{Func: name, FuncArg: args})
+		b.lastHandler, b.lastIndex = builderHandlerOnSuccess, len(transition.OnSuccess)-1
+	}
+
+	return b
+}
+
+// OnSuccessFunc binds an on_success function to the selected transition
+func (b *Builder) OnSuccessFunc(handler HandlerFuncContext, args ...string) *Builder {
+	name := b.funcName(builderHandlerOnSuccess)
+	b.onSuccess[name] = handler
+	return b.OnSuccess(name, args...)
+}
+
+// Trigger adds an on_success that processes the transition to the next state on another state machine
+func (b *Builder) Trigger(name string, stateMachine IStateMachine, nextState string) *Builder {
+	if stateMachine != nil {
+		b.triggers[name] = stateMachine
+	}
+
+	if transition := b.currentTransitionInput("Trigger"); transition != nil {
+		transition.OnSuccess = append(transition.OnSuccess, OnSuccessInputStruct{
+			Func:           name,
+			FuncArg:        []string{name, nextState},
+			IsStateMachine: true,
+		})
+		b.lastHandler, b.lastIndex = builderHandlerOnSuccess, len(transition.OnSuccess)-1
+	}
+
+	return b
+}
+
+// OnEnter adds a registered on_success function run when entering the selected state
+func (b *Builder) OnEnter(name string, args ...string) *Builder {
+	if state := b.currentStateInput("OnEnter"); state != nil {
+		state.OnEnter = append(state.OnEnter, OnSuccessInputStruct{Func: name, FuncArg: args})
+		b.lastHandler, b.lastIndex = builderHandlerOnEnter, len(state.OnEnter)-1
+	}
+
+	return b
+}
+
+// OnExit adds a registered on_success function run when leaving the selected state
+func (b *Builder) OnExit(name string, args ...string) *Builder {
+	if state := b.currentStateInput("OnExit"); state != nil {
+		state.OnExit = append(state.OnExit, OnSuccessInputStruct{Func: name, FuncArg: args})
+		b.lastHandler, b.lastIndex = builderHandlerOnExit, len(state.OnExit)-1
+	}
+
+	return b
+}
+
+// BeforeTransition adds a registered on_success function run before the execute of every transition
+func (b *Builder) BeforeTransition(name string, args ...string) *Builder {
+	b.definition.BeforeTransition = append(b.definition.BeforeTransition, OnSuccessInputStruct{Func: name, FuncArg: args})
+	b.lastHandler, b.lastIndex = builderHandlerBefore, len(b.definition.BeforeTransition)-1
+
+	return b
+}
+
+// AfterTransition adds a registered on_success function run after the on_success of every transition
+func (b *Builder) AfterTransition(name string, args ...string) *Builder {
+	b.definition.AfterTransition = append(b.definition.AfterTransition, OnSuccessInputStruct{Func: name, FuncArg: args})
+	b.lastHandler, b.lastIndex = builderHandlerAfter, len(b.definition.AfterTransition)-1
+
+	return b
+}
+
+// Adapter sets the adapter of the last on_success
+func (b *Builder) Adapter(name string) *Builder {
+	if onSuccess := b.lastOnSuccess("Adapter"); onSuccess != nil {
+		onSuccess.Adapter = name
+	}
+
+	return b
+}
+
+// Compensate sets the compensate of the last on_success, CompensateRevert reverts a triggered state machine
+func (b *Builder) Compensate(name string, args ...string) *Builder {
+	if onSuccess := b.lastOnSuccess("Compensate"); onSuccess != nil {
+		onSuccess.Compensate = formatFunction(name, args)
+	}
+
+	return b
+}
+
+// CompensateFunc binds the compensate function of the last on_success
+func (b *Builder) CompensateFunc(handler HandlerFuncContext, args ...string) *Builder {
+	name := b.funcName(builderHandlerCompensate)
+	b.compensate[name] = handler
+	return b.Compensate(name, args...)
+}
+
+// Retry sets the retry policy of the last on_success like handler, or of the execute function in the selected
+// transition when no handler follows it
+func (b *Builder) Retry(policy RetryPolicy) *Builder {
+	input := policy.Input()
+	switch b.lastHandler {
+	case "":
+		if transition := b.currentTransitionInput("Retry"); transition != nil {
+			transition.Retry = &input
+		}
+		return b
+	case builderHandlerCheck, builderHandlerOnError:
+		b.fail("Retry called after a %s handler, only the execute function and the on_success like handlers are retried", b.lastHandler)
+		return b
+	}
+
+	if onSuccess := b.lastOnSuccess("Retry"); onSuccess != nil {
+		if onSuccess.IsStateMachine {
+			b.fail("Retry called after Trigger, the triggered state machines are not retried")
+			return b
+		}
+		onSuccess.Retry = &input
+	}
+
+	return b
+}
+
+// Filter sets the filter of the last on_success
+func (b *Builder) Filter(name string) *Builder {
+	if onSuccess := b.lastOnSuccess("Filter"); onSuccess != nil {
+		onSuccess.Filter = name
+	}
+
+	return b
+}
+
+// OnError adds a registered on_error function to the selected transition
+func (b *Builder) OnError(name string, args ...string) *Builder {
+	if transition := b.currentTransitionInput("OnError"); transition != nil {
+		transition.OnError = append(transition.OnError, OnErrorInputStruct{Func: name, FuncArg: args})
+		b.lastHandler, b.lastIndex = builderHandlerOnError, len(transition.OnError)-1
+	}
+
+	return b
+}
+
+// OnErrorFunc binds an on_error function to the selected transition
+func (b *Builder) OnErrorFunc(handler HandlerFuncContext, args ...string) *Builder {
+	name := b.funcName(builderHandlerOnError)
+	b.onError[name] = handler
+	return b.OnError(name, args...)
+}
+
+// IgnoreError ignores the errors of the last handler
+func (b *Builder) IgnoreError() *Builder {
+	return b.setIgnore("IgnoreError", true, false)
+}
+
+// IgnoreNoSuccess ignores the no success of the last handler
+func (b *Builder) IgnoreNoSuccess() *Builder {
+	return b.setIgnore("IgnoreNoSuccess", false, true)
+}
+
+// Execute binds the execute function
+func (b *Builder) Execute(handler HandlerExecFunctionContext) *Builder {
+	b.execute = handler
+	return b
+}
+
+// CurrentState binds the current state function
+func (b *Builder) CurrentState(handler CurrentStateFuncContext) *Builder {
+	b.currentState = handler
+	return b
+}
+
+// Definition returns a copy of the definition built so far
+func (b *Builder) Definition() (Definition, error) {
+	if b.err != nil {
+		return Definition{}, b.err
+	}
+
+	return copyDefinition(b.definition)
+}
+
+// Build creates the state machine, registering the functions bound in the builder.
+// The state machine gets a copy of the definition, the builder can go on without changing it.
+func (b *Builder) Build() (*StateMachine, error) {
+	definition, err := b.Definition()
+	if err != nil {
+		return nil, err
+	}
+
+	sm := NewStateMachine(b.opts...)
+	for name, handler := range b.checks {
+		sm.AddCheckFunctionContext(name, handler)
+	}
+	for name, handler := range b.onSuccess {
+		sm.AddOnSuccessFunctionContext(name, handler)
+	}
+	for name, handler := range b.onError {
+		sm.AddOnErrorFunctionContext(name, handler)
+	}
+	for name, handler := range b.compensate {
+		sm.AddCompensateFunctionContext(name, handler)
+	}
+	for name, stateMachine := range b.triggers {
+		sm.AddStateMachineToTrigger(name, stateMachine)
+	}
+	if b.execute != nil {
+		sm.AddExecuteFunctionContext(b.execute)
+	}
+	if b.currentState != nil {
+		sm.AddCurrentStateFunctionContext(b.currentState)
+	}
+
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+	if err = sm.applyDefinition(definition); err != nil {
+		return nil, err
+	}
+
+	return sm, nil
+}
+
+// copyDefinition deep copies a definition, its documents hold every field of the definition
+func copyDefinition(definition Definition) (Definition, error) {
+	data, err := json.Marshal(definition)
+	if err != nil {
+		return Definition{}, err
+	}
+
+	var copied Definition
+	err = json.Unmarshal(data, &copied)
+	return copied, err
+}
+
+func (b *Builder) currentStateInput(method string) *StateInput {
+	if b.state < 0 {
+		b.fail("%s called before State", method)
+		return nil
+	}
+
+	return &(*b.states())[b.state]
+}
+
+func (b *Builder) currentTransitionInput(method string) *TransitionInput {
+	state := b.currentStateInput(method)
+	if state == nil {
+		return nil
+	}
+
+	if b.transition == builderCreateTransition {
+		if state.Create == nil {
+			state.Create = &TransitionInput{}
+		}
+		return state.Create
+	}
+
+	if b.transition < 0 || b.transition >= len(state.Transitions) {
+		b.fail("%s called before Transition on state [%s]", method, state.Name)
+		return nil
+	}
+
+	return &state.Transitions[b.transition]
+}
+
+// lastOnSuccess returns the last on_success like handler (on_success, on_enter, on_exit, ...)
+func (b *Builder) lastOnSuccess(method string) *OnSuccessInputStruct {
+	switch b.lastHandler {
+	case builderHandlerBefore:
+		return &b.definition.BeforeTransition[b.lastIndex]
+	case builderHandlerAfter:
+		return &b.definition.AfterTransition[b.lastIndex]
+	case builderHandlerOnEnter:
+		return &(*b.states())[b.state].OnEnter[b.lastIndex]
+	case builderHandlerOnExit:
+		return &(*b.states())[b.state].OnExit[b.lastIndex]
+	case builderHandlerOnSuccess:
+		if transition := b.currentTransitionInput(method); transition != nil {
+			return &transition.OnSuccess[b.lastIndex]
+		}
+		return nil
+	default:
+		b.fail("%s called before OnSuccess", method)
+		return nil
+	}
+}
+
+func (b *Builder) setIgnore(method string, ignoreError, ignoreNoSuccess bool) *Builder {
+	var handlerIgnoreError, handlerIgnoreNoSuccess *bool
+
+	switch b.lastHandler {
+	case builderHandlerCheck:
+		if transition := b.currentTransitionInput(method); transition != nil {
+			handler := &transition.Check[b.lastIndex]
+			handlerIgnoreError, handlerIgnoreNoSuccess = &handler.IgnoreError, &handler.IgnoreNoSuccess
+		}
+	case builderHandlerOnError:
+		if transition := b.currentTransitionInput(method); transition != nil {
+			handler := &transition.OnError[b.lastIndex]
+			handlerIgnoreError, handlerIgnoreNoSuccess = &handler.IgnoreError, &handler.IgnoreNoSuccess
+		}
+	case "":
+		b.fail("%s called before adding a handler", method)
+	default:
+		if handler := b.lastOnSuccess(method); handler != nil {
+			handlerIgnoreError, handlerIgnoreNoSuccess = &handler.IgnoreError, &handler.IgnoreNoSuccess
+		}
+	}
+
+	if handlerIgnoreError != nil {
+		*handlerIgnoreError = *handlerIgnoreError || ignoreError
+		*handlerIgnoreNoSuccess = *handlerIgnoreNoSuccess || ignoreNoSuccess
+	}
+
+	return b
+}
+
+// funcName generates the name under which a bound function is registered
+func (b *Builder) funcName(kind string) string {
+	b.funcs++
+	return fmt.Sprintf("%s#%d", kind, b.funcs)
+}
+
+// fail keeps the first error, which is returned by Build
+func (b *Builder) fail(format string, args ...any) {
+	if b.err == nil {
+		b.err = fmt.Errorf("state machine builder [%s]: "+format, append([]any{b.definition.Name}, args...)...)
+	}
+}
@@ -0,0 +1,140 @@
+package state_machine
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	var calls []string
+	record := func(name string) HandlerFuncContext {
+		return func(_ context.Context, _ any, args ...string) (bool, error) {
+			calls = append(calls, name+strings.Join(args, ","))
+			return true, nil
+		}
+	}
+
+	state := "new"
+	builder := NewBuilder("orders").
+		State("new").Initial().
+		Transition("paid").Event("pay").CheckFunc(record("check"), "ADMIN").OnSuccessFunc(record("notify")).
+		State("paid").Final().
+		Execute(func(_ context.Context, nextState string, _ any) error {
+			calls = append(calls, "execute "+nextState)
+			state = nextState
+			return nil
+		}).
+		CurrentState(func(context.Context, any) (string, error) { return state, nil })
+
+	sm, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if success, err := sm.Fire("pay", struct{}{}); !success || err != nil {
+		t.Fatalf("Fire = %v, %v, want a success", success, err)
+	}
+	if want := []string{"checkADMIN", "execute paid", "notify"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+
+	want := Definition{Name: "orders", States: []StateInput{
+		{Name: "new", Initial: true, Transitions: []TransitionInput{{
+			Name:      "paid",
+			Event:     "pay",
+			Check:     []CheckInputStruct{{Func: "check#1", FuncArg: []string{"ADMIN"}}},
+			OnSuccess: []OnSuccessInputStruct{{Func: "on_success#2"}},
+		}}},
+		{Name: "paid", Final: true},
+	}}
+	if definition := sm.GetDefinition(); !reflect.DeepEqual(definition, want) {
+		t.Errorf("GetDefinition() = %+v, want %+v", definition, want)
+	}
+}
+
+func TestBuilderCopiesTheDefinition(t *testing.T) {
+	builder := NewBuilder("orders").
+		State("new").Initial().Transition("paid").Check("isPaid").
+		State("paid").Final()
+
+	sm, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, wantStates := sm.GetDefinition(), append([]StateInput(nil), sm.States...)
+
+	builder.State("new").Transition("canceled").Check("isCanceled").
+		State("paid").OnEnter("notify").
+		State("canceled").Final()
+	if definition, _ := builder.Definition(); len(definition.States) != 3 {
+		t.Fatalf("builder states = %v, want 3", definition.States)
+	}
+
+	if definition := sm.GetDefinition(); !reflect.DeepEqual(definition, want) {
+		t.Errorf("GetDefinition() after the builder changed = %+v, want %+v", definition, want)
+	}
+	if !reflect.DeepEqual(sm.States, wantStates) {
+		t.Errorf("States after the builder changed = %+v, want %+v", sm.States, wantStates)
+	}
+}
+
+func TestBuilderErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		build   func(b *Builder) *Builder
+		wantErr string
+	}{
+		{
+			name:    "transition before state",
+			build:   func(b *Builder) *Builder { return b.Transition("paid") },
+			wantErr: "Transition called before State",
+		},
+		{
+			name:    "check before transition",
+			build:   func(b *Builder) *Builder { return b.State("new").Check("isPaid") },
+			wantErr: "Check called before Transition on state [new]",
+		},
+		{
+			name:    "adapter before on_success",
+			build:   func(b *Builder) *Builder { return b.State("new").Transition("paid").Adapter("items") },
+			wantErr: "Adapter called before OnSuccess",
+		},
+		{
+			name: "retry of a check",
+			build: func(b *Builder) *Builder {
+				return b.State("new").Transition("paid").Check("isPaid").Retry(RetryPolicy{Max: 1})
+			},
+			wantErr: "Retry called after a check handler",
+		},
+		{
+			name: "retry of a trigger",
+			build: func(b *Builder) *Builder {
+				return b.State("new").Transition("paid").Trigger("invoices", nil, "sent").Retry(RetryPolicy{Max: 1})
+			},
+			wantErr: "Retry called after Trigger",
+		},
+		{
+			name:    "ignore error before a handler",
+			build:   func(b *Builder) *Builder { return b.State("new").Transition("paid").IgnoreError() },
+			wantErr: "IgnoreError called before adding a handler",
+		},
+		{
+			name: "the first error is kept",
+			build: func(b *Builder) *Builder {
+				return b.Initial().State("new").Transition("paid").Filter("items")
+			},
+			wantErr: "Initial called before State",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sm, err := test.build(NewBuilder("orders")).Build()
+			if sm != nil || err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("Build() = %v, %v, want an error with %q", sm, err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package state_machine
+
+import (
+	"context"
+	"time"
+)
+
+// CompensateRevert the compensate of a triggered state machine that reverts it to its previous state,
+// running the compensations of its own completed on_success handlers first
+const CompensateRevert = "revert"
+
+// CompensationResult the result of a compensation
+type CompensationResult struct {
+	// Machine of the compensated handler
+	Machine string `json:"machine"`
+	// Handler the compensated on_success handler or triggered state machine
+	Handler string `json:"handler"`
+	// Compensate the compensate handler, CompensateRevert when a triggered state machine is reverted
+	Compensate string `json:"compensate"`
+	// Success
+	Success bool `json:"success"`
+	// Err
+	Err error `json:"-"`
+}
+
+// compensation a completed step to undo when the transition fails
+type compensation struct {
+	machine    string
+	handler    string
+	compensate string
+	run        func(ctx context.Context) (bool, error)
+}
+
+// compensationCollector receives the compensations of a triggered state machine that completed its transition
+type compensationCollector struct {
+	compensations []compensation
+}
+
+type compensationCollectorKey struct{}
+
+// compensationContext a context without the cancellation and the transaction of its parent,
+// so the compensations run to completion once the transaction is rolled back
+type compensationContext struct {
+	context.Context
+}
+
+func (compensationContext) Deadline() (deadline time.Time, ok bool) { return }
+func (compensationContext) Done() <-chan struct{}                   { return nil }
+func (compensationContext) Err() error                              { return nil }
+
+func (c compensationContext) Value(key any) any {
+	if _, ok := key.(txContextKey); ok {
+		return nil
+	}
+	return c.Context.Value(key)
+}
+
+// addCompensation adds the compensation of a completed on_success handler
+func (sm *StateMachine) addCompensation(run *transitionRun, handler OnSuccessStruct, obj any) {
+	if handler.Compensate == "" || handler.IsStateMachine {
+		return
+	}
+
+	run.compensations = append(run.compensations, compensation{
+		machine:    run.machine,
+		handler:    handler.Func,
+		compensate: handler.Compensate,
+		run: func(ctx context.Context) (bool, error) {
+			handlerFunc := sm.getCompensateFunction(handler.Compensate)
+			if handlerFunc == nil {
+				return false, &ErrHandlerNotRegistered{Machine: run.machine, Kind: ValidationKindCompensate, Name: handler.Compensate}
+			}
+			return handlerFunc(ctx, obj, handler.CompensateArg...)
+		},
+	})
+}
+
+// handOverCompensations gives the compensations of a completed transition to the transition that triggered it,
+// when it declared the revert of the state machine
+func (sm *StateMachine) handOverCompensations(ctx context.Context, run *transitionRun, obj any) {
+	collector, _ := ctx.Value(compensationCollectorKey{}).(*compensationCollector)
+	if collector == nil {
+		return
+	}
+
+	if run.from != "" {
+		collector.compensations = append(collector.compensations, compensation{
+			machine:    run.machine,
+			handler:    run.to,
+			compensate: CompensateRevert,
+			run: func(ctx context.Context) (bool, error) {
+				if err := sm.revertState(ctx, run, obj); err != nil {
+					return false, err
+				}
+				return true, nil
+			},
+		})
+	}
+
+	collector.compensations = append(collector.compensations, run.compensations...)
+}
+
+// compensate runs the compensations of the completed steps in reverse order
+func (sm *StateMachine) compensate(ctx context.Context, run *transitionRun, err error) error {
+	if len(run.compensations) == 0 {
+		return err
+	}
+
+	ctx = compensationContext{Context: ctx}
+	compensated := &ErrTransitionCompensated{Machine: run.machine, Err: err}
+	for i := len(run.compensations) - 1; i >= 0; i-- {
+		step := run.compensations[i]
+		success, compensateErr := step.run(ctx)
+		compensated.Compensations = append(compensated.Compensations, CompensationResult{
+			Machine:    step.machine,
+			Handler:    step.handler,
+			Compensate: step.compensate,
+			Success:    success && compensateErr == nil,
+			Err:        compensateErr,
+		})
+	}
+	run.compensations = nil
+
+	return compensated
+}
+
+func (sm *StateMachine) AddCompensateFunction(name string, handler HandlerFunc) {
+	sm.register(func() {
+		sm.CompensateHandlers[name] = handler
+		delete(sm.compensateHandlers, name)
+	})
+}
+
+func (sm *StateMachine) AddCompensateFunctionContext(name string, handler HandlerFuncContext) {
+	sm.register(func() {
+		sm.compensateHandlers[name] = handler
+		delete(sm.CompensateHandlers, name)
+	})
+}
+
+func (sm *StateMachine) getCompensateFunction(name string) HandlerFuncContext {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	return sm.compensateFunction(name)
+}
+
+// compensateFunction returns the compensation registered with or without a context, the caller must hold the lock
+func (sm *StateMachine) compensateFunction(name string) HandlerFuncContext {
+	return lookupHandler(sm.frozen, sm.compensateHandlers, sm.CompensateHandlers, name, handlerFuncWithContext)
+}
@@ -0,0 +1,191 @@
+package state_machine
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCompensation(t *testing.T) {
+	errCharge := errors.New("charge failed")
+
+	tests := []struct {
+		name        string
+		charge      HandlerFunc
+		wantErr     error
+		wantCalls   []string
+		wantResults []CompensationResult
+	}{
+		{
+			name:      "compensates the completed handlers in reverse order",
+			charge:    func(any, ...string) (bool, error) { return false, errCharge },
+			wantErr:   errCharge,
+			wantCalls: []string{"reserve", "notify", "charge", "unnotify", "release stock"},
+			wantResults: []CompensationResult{
+				{Machine: "orders", Handler: "notify", Compensate: "unnotify", Success: true},
+				{Machine: "orders", Handler: "reserve", Compensate: "release", Success: true},
+			},
+		},
+		{
+			name:      "compensates a handler without success",
+			charge:    func(any, ...string) (bool, error) { return false, nil },
+			wantCalls: []string{"reserve", "notify", "charge", "unnotify", "release stock"},
+			wantResults: []CompensationResult{
+				{Machine: "orders", Handler: "notify", Compensate: "unnotify", Success: true},
+				{Machine: "orders", Handler: "reserve", Compensate: "release", Success: true},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var calls []string
+			record := func(name string) HandlerFunc {
+				return func(_ any, args ...string) (bool, error) {
+					if len(args) > 0 {
+						name += " " + args[0]
+					}
+					calls = append(calls, name)
+					return true, nil
+				}
+			}
+
+			sm := NewStateMachine()
+			if err := sm.LoadFromBytes([]byte(`{"name":"orders","states":[
+				{"name":"pending","initial":true,"transitions":[{"name":"paid","on_success":[
+					{"func":"reserve","compensate":"release(stock)"},
+					{"func":"notify","compensate":"unnotify"},
+					{"func":"charge"}]}]},
+				{"name":"paid","final":true}]}`), "json"); err != nil {
+				t.Fatal(err)
+			}
+			sm.AddCurrentStateFunction(func(any) (string, error) { return "pending", nil })
+			sm.AddExecuteFunction(func(string, any) error { return nil })
+			sm.AddOnSuccessFunction("reserve", record("reserve"))
+			sm.AddOnSuccessFunction("notify", record("notify"))
+			sm.AddOnSuccessFunction("charge", func(obj any, args ...string) (bool, error) {
+				calls = append(calls, "charge")
+				return test.charge(obj, args...)
+			})
+			sm.AddCompensateFunction("release", record("release"))
+			sm.AddCompensateFunction("unnotify", record("unnotify"))
+
+			success, err := sm.ProcessTransition("paid", struct{}{})
+			var compensated *ErrTransitionCompensated
+			if success || !errors.As(err, &compensated) {
+				t.Fatalf("ProcessTransition = %v, %v, want an ErrTransitionCompensated", success, err)
+			}
+			if compensated.Err != test.wantErr && !errors.Is(compensated.Err, test.wantErr) {
+				t.Errorf("compensated error = %v, want %v", compensated.Err, test.wantErr)
+			}
+			if !compensated.Succeeded() || !reflect.DeepEqual(compensated.Compensations, test.wantResults) {
+				t.Errorf("compensations = %+v, want %+v", compensated.Compensations, test.wantResults)
+			}
+			if !reflect.DeepEqual(calls, test.wantCalls) {
+				t.Errorf("calls = %v, want %v", calls, test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestCompensateRevert(t *testing.T) {
+	tests := []struct {
+		name string
+		// rollback moves the stored state of the invoice back, like a transaction rolled back
+		rollback        bool
+		wantVersion     int64
+		wantInvoiceCall []string
+	}{
+		{
+			name:            "reverts the triggered state machine",
+			wantVersion:     3,
+			wantInvoiceCall: []string{"execute sent", "mail", "unmail", "execute draft"},
+		},
+		{
+			name:            "skips the execute of a state machine already back in its state",
+			rollback:        true,
+			wantVersion:     1,
+			wantInvoiceCall: []string{"execute sent", "mail", "unmail"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var calls, invoiceCalls []string
+			store := NewMemoryStateStore()
+			store.states["invoice-1"] = memoryState{state: "draft", version: 1}
+
+			invoices := NewStateMachine(WithStateStore(store, func(any) string { return "invoice-1" }))
+			if err := invoices.LoadFromBytes([]byte(`{"name":"invoices","states":[
+				{"name":"draft","initial":true,"transitions":[{"name":"sent","on_success":[{"func":"mail","compensate":"unmail"}]}]},
+				{"name":"sent","final":true}]}`), "json"); err != nil {
+				t.Fatal(err)
+			}
+			invoices.AddExecuteFunction(func(nextState string, _ any) error {
+				invoiceCalls = append(invoiceCalls, "execute "+nextState)
+				return nil
+			})
+			invoices.AddOnSuccessFunction("mail", func(any, ...string) (bool, error) {
+				invoiceCalls = append(invoiceCalls, "mail")
+				return true, nil
+			})
+			invoices.AddCompensateFunction("unmail", func(any, ...string) (bool, error) {
+				invoiceCalls = append(invoiceCalls, "unmail")
+				return true, nil
+			})
+
+			orders := NewStateMachine()
+			orders.AddStateMachineToTrigger("invoices", invoices)
+			if err := orders.LoadFromBytes([]byte(`{"name":"orders","states":[
+				{"name":"pending","initial":true,"transitions":[{"name":"paid","on_success":[
+					{"func":"reserve","compensate":"release"},
+					{"func":"invoices","func_arg":["invoices","sent"],"is_state_machine":true,"compensate":"revert"},
+					{"func":"charge"}]}]},
+				{"name":"paid","final":true}]}`), "json"); err != nil {
+				t.Fatal(err)
+			}
+			orders.AddCurrentStateFunction(func(any) (string, error) { return "pending", nil })
+			orders.AddExecuteFunction(func(string, any) error { return nil })
+			orders.AddOnSuccessFunction("reserve", func(any, ...string) (bool, error) {
+				calls = append(calls, "reserve")
+				return true, nil
+			})
+			orders.AddOnSuccessFunction("charge", func(any, ...string) (bool, error) {
+				if test.rollback {
+					store.states["invoice-1"] = memoryState{state: "draft", version: 1}
+				}
+				return false, errors.New("charge failed")
+			})
+			orders.AddCompensateFunction("release", func(any, ...string) (bool, error) {
+				calls = append(calls, "release")
+				return true, nil
+			})
+
+			success, err := orders.ProcessTransition("paid", struct{}{})
+			var compensated *ErrTransitionCompensated
+			if success || !errors.As(err, &compensated) || !compensated.Succeeded() {
+				t.Fatalf("ProcessTransition = %v, %v, want a successful ErrTransitionCompensated", success, err)
+			}
+
+			wantResults := []CompensationResult{
+				{Machine: "invoices", Handler: "mail", Compensate: "unmail", Success: true},
+				{Machine: "invoices", Handler: "sent", Compensate: CompensateRevert, Success: true},
+				{Machine: "orders", Handler: "reserve", Compensate: "release", Success: true},
+			}
+			if !reflect.DeepEqual(compensated.Compensations, wantResults) {
+				t.Errorf("compensations = %+v, want %+v", compensated.Compensations, wantResults)
+			}
+			if !reflect.DeepEqual(invoiceCalls, test.wantInvoiceCall) {
+				t.Errorf("invoice calls = %v, want %v", invoiceCalls, test.wantInvoiceCall)
+			}
+			if want := []string{"reserve", "release"}; !reflect.DeepEqual(calls, want) {
+				t.Errorf("order calls = %v, want %v", calls, want)
+			}
+
+			if state, version, _ := store.Get(context.Background(), "invoice-1"); state != "draft" || version != test.wantVersion {
+				t.Errorf("stored invoice = %s, %d, want draft, %d", state, version, test.wantVersion)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package state_machine
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+const concurrencyDefinition = `{"name":"orders","states":[
+	{"name":"pending","initial":true,"transitions":[{"name":"paid","check":[{"func":"isPaid"}],"on_success":[{"func":"notify"}]}]},
+	{"name":"paid","transitions":[{"name":"pending"}]}]}`
+
+// TestConcurrentUse runs transitions, registrations and loads of definitions at the same time, run it with -race
+func TestConcurrentUse(t *testing.T) {
+	sm := NewStateMachine()
+	filePath := definitionFile(t, concurrencyDefinition)
+	if err := sm.Load(filePath); err != nil {
+		t.Fatal(err)
+	}
+
+	var states sync.Map
+	sm.AddCurrentStateFunction(func(obj any) (string, error) {
+		state, _ := states.LoadOrStore(obj, "pending")
+		return state.(string), nil
+	})
+	sm.AddExecuteFunction(func(nextState string, obj any) error {
+		states.Store(obj, nextState)
+		return nil
+	})
+	sm.AddCheckFunction("isPaid", func(any, ...string) (bool, error) { return true, nil })
+	sm.AddOnSuccessFunction("notify", func(any, ...string) (bool, error) { return true, nil })
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(3)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				obj := fmt.Sprintf("order-%d-%d", worker, i)
+				if _, err := sm.ProcessTransition("paid", obj); err != nil {
+					t.Errorf("ProcessTransition: %v", err)
+				}
+			}
+		}(worker)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				sm.AddOnSuccessFunction(fmt.Sprintf("handler-%d-%d", worker, i), func(any, ...string) (bool, error) { return true, nil })
+			}
+		}(worker)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				if err := sm.Load(filePath); err != nil {
+					t.Errorf("Load: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRegisterAfterFreeze(t *testing.T) {
+	sm := NewStateMachine()
+	loadDefinition(t, sm, concurrencyDefinition)
+	sm.Freeze()
+
+	defer func() {
+		err, _ := recover().(error)
+		var frozen *ErrFrozen
+		if !errors.As(err, &frozen) {
+			t.Fatalf("recovered %v, want an ErrFrozen panic", err)
+		}
+		if frozen.Machine != "orders" {
+			t.Errorf("ErrFrozen.Machine = %s, want orders", frozen.Machine)
+		}
+	}()
+
+	sm.AddCheckFunction("isPaid", func(any, ...string) (bool, error) { return true, nil })
+	t.Fatal("AddCheckFunction after Freeze did not panic")
+}
+
+func TestLoadAfterFreeze(t *testing.T) {
+	sm := NewStateMachine()
+	sm.Freeze()
+
+	err := sm.Load(definitionFile(t, concurrencyDefinition))
+	var frozen *ErrFrozen
+	if !errors.As(err, &frozen) {
+		t.Fatalf("Load after Freeze = %v, want ErrFrozen", err)
+	}
+}
+
+// TestExportedMapsAfterFreeze changes the exported handler maps of a frozen state machine during its transitions,
+// run it with -race
+func TestExportedMapsAfterFreeze(t *testing.T) {
+	sm := NewStateMachine()
+	loadDefinition(t, sm, concurrencyDefinition)
+	sm.AddCurrentStateFunction(func(any) (string, error) { return "pending", nil })
+	sm.AddExecuteFunction(func(string, any) error { return nil })
+	sm.CheckHandlers["isPaid"] = func(any, ...string) (bool, error) { return true, nil }
+	sm.AddOnSuccessFunction("notify", func(any, ...string) (bool, error) { return true, nil })
+	sm.Freeze()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if success, err := sm.ProcessTransition("paid", struct{}{}); !success || err != nil {
+				t.Errorf("ProcessTransition = %v, %v, want the handlers of the frozen state machine", success, err)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			sm.CheckHandlers["isPaid"] = func(any, ...string) (bool, error) { return false, nil }
+			delete(sm.OnSuccessHandlers, "notify")
+		}
+	}()
+	wg.Wait()
+}
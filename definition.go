@@ -0,0 +1,221 @@
+package state_machine
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Definition formats
+const (
+	DefinitionFormatJSON = "json"
+	DefinitionFormatYAML = "yaml"
+	DefinitionFormatYML  = "yml"
+	DefinitionFormatTOML = "toml"
+)
+
+// GetDefinition rebuilds the definition of the state machine from its states and handlers
+func (sm *StateMachine) GetDefinition() Definition {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+
+	definition := Definition{
+		Name:             sm.Name,
+		BeforeTransition: definitionOnSuccess(sm.BeforeTransition),
+		AfterTransition:  definitionOnSuccess(sm.AfterTransition),
+	}
+
+	// keep the declared order of states and transitions, the remaining ones are sorted
+	declared := make(map[string]bool)
+	var states []string
+	transitions := make(map[string][]string)
+	for _, state := range sm.States {
+		if !declared[state.Name] {
+			declared[state.Name] = true
+			states = append(states, state.Name)
+		}
+		for _, transition := range state.Transitions {
+			transitions[state.Name] = append(transitions[state.Name], transition.Name)
+		}
+	}
+	for _, state := range append(sortedKeys(sm.MapStates), append(sortedKeys(sm.OnEnter), sortedKeys(sm.OnExit)...)...) {
+		if !declared[state] {
+			declared[state] = true
+			states = append(states, state)
+		}
+	}
+
+	for _, state := range states {
+		stateInput := StateInput{
+			Name:         state,
+			Final:        sm.finalStates[state],
+			Parent:       sm.parents[state],
+			InitialChild: sm.initialChildren[state],
+			OnEnter:      definitionOnSuccess(sm.OnEnter[state]),
+			OnExit:       definitionOnSuccess(sm.OnExit[state]),
+		}
+
+		if state == sm.initialState {
+			stateInput.Initial = true
+			if !isEmptyHandlers(sm.initialHandlers) {
+				create := definitionTransition("", sm.initialHandlers)
+				stateInput.Create = &create
+			}
+		}
+
+		seen := make(map[string]bool)
+		for _, transition := range append(transitions[state], sortedKeys(sm.MapStates[state])...) {
+			handlers, ok := sm.MapStates[state][transition]
+			if !ok || seen[transition] {
+				continue
+			}
+			seen[transition] = true
+			stateInput.Transitions = append(stateInput.Transitions, definitionTransition(transition, handlers))
+		}
+
+		definition.States = append(definition.States, stateInput)
+	}
+
+	definition.States, definition.Regions = sm.regionStates(definition.States)
+
+	return definition
+}
+
+// MarshalDefinition serializes the definition of the state machine in the given format (json, yaml or toml),
+// the result can be loaded back with LoadFromBytes
+func (sm *StateMachine) MarshalDefinition(format string) ([]byte, error) {
+	return MarshalDefinition(sm.GetDefinition(), format)
+}
+
+// MarshalDefinition serializes a definition in the given format (json, yaml or toml)
+func MarshalDefinition(definition Definition, format string) ([]byte, error) {
+	data, err := json.MarshalIndent(definition, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case DefinitionFormatJSON:
+		return data, nil
+	case DefinitionFormatYAML, DefinitionFormatYML, DefinitionFormatTOML:
+		// the other formats are encoded from the json document, so the json keys are kept
+		var document map[string]any
+		if err = json.Unmarshal(data, &document); err != nil {
+			return nil, err
+		}
+
+		if format == DefinitionFormatTOML {
+			return toml.Marshal(document)
+		}
+		return yaml.Marshal(document)
+	default:
+		return nil, fmt.Errorf("unsupported definition format [%s]", format)
+	}
+}
+
+// definitionTransition rebuilds the definition of a transition from its handlers
+func definitionTransition(name string, handlers Handlers) TransitionInput {
+	transition := TransitionInput{Name: name, Event: handlers.Event, Join: definitionJoin(handlers.Join)}
+	if handlers.After > 0 {
+		transition.After = handlers.After.String()
+	}
+	transition.Retry = definitionRetry(handlers.Retry)
+
+	if handlers.Guard != nil {
+		guard := handlers.Guard.Input()
+		transition.Guard = &guard
+	}
+
+	transition.Check = definitionChecks(handlers.Check)
+
+	transition.OnSuccess = definitionOnSuccess(handlers.OnSuccess)
+
+	for _, onError := range handlers.OnError {
+		funcName, args := definitionFunction(onError.Func, onError.FuncArg)
+		transition.OnError = append(transition.OnError, OnErrorInputStruct{
+			Func:            funcName,
+			FuncArg:         args,
+			IgnoreError:     onError.IgnoreError,
+			IgnoreNoSuccess: onError.IgnoreNoSuccess,
+		})
+	}
+
+	return transition
+}
+
+// definitionChecks rebuilds the definition of checks, with their all/any/not groups
+func definitionChecks(checks []CheckStruct) (inputs []CheckInputStruct) {
+	for _, check := range checks {
+		input := CheckInputStruct{
+			All:             definitionChecks(check.All),
+			Any:             definitionChecks(check.Any),
+			IgnoreError:     check.IgnoreError,
+			IgnoreNoSuccess: check.IgnoreNoSuccess,
+		}
+
+		if check.Not != nil {
+			input.Not = &definitionChecks([]CheckStruct{*check.Not})[0]
+		}
+
+		if check.Func != "" {
+			input.Func, input.FuncArg = definitionFunction(check.Func, check.FuncArg)
+		}
+
+		inputs = append(inputs, input)
+	}
+
+	return inputs
+}
+
+// definitionOnSuccess rebuilds the definition of on_success like handlers (on_success, on_enter, on_exit, ...)
+func definitionOnSuccess(handlers []OnSuccessStruct) (inputs []OnSuccessInputStruct) {
+	for _, onSuccess := range handlers {
+		funcName, args := definitionFunction(onSuccess.Func, onSuccess.FuncArg)
+		inputs = append(inputs, OnSuccessInputStruct{
+			Func:            funcName,
+			FuncArg:         args,
+			Adapter:         onSuccess.Adapter,
+			Filter:          onSuccess.Filter,
+			IsStateMachine:  onSuccess.IsStateMachine,
+			Compensate:      formatFunction(onSuccess.Compensate, onSuccess.CompensateArg),
+			Retry:           definitionRetry(onSuccess.Retry),
+			IgnoreError:     onSuccess.IgnoreError,
+			IgnoreNoSuccess: onSuccess.IgnoreNoSuccess,
+		})
+	}
+
+	return inputs
+}
+
+// definitionRetry rebuilds the definition of a retry policy, nil without one
+func definitionRetry(policy *RetryPolicy) *RetryPolicyInput {
+	if policy == nil {
+		return nil
+	}
+
+	input := policy.Input()
+	return &input
+}
+
+// definitionFunction uses the func(arg1, arg2) form when it parses back to the same function and arguments,
+// otherwise the arguments are kept apart in func_arg
+func definitionFunction(name string, args []string) (string, []string) {
+	formatted := formatFunction(name, args)
+	funcName, funcArgs := splitFunctionAndArguments(formatted)
+	if funcName != name || len(funcArgs) != len(args) {
+		return name, args
+	}
+
+	for i := range args {
+		if funcArgs[i] != args[i] {
+			return name, args
+		}
+	}
+
+	return formatted, nil
+}
+
+func isEmptyHandlers(handlers Handlers) bool {
+	return handlers.Guard == nil && handlers.Join == nil && handlers.After == 0 && handlers.Retry == nil && len(handlers.Check) == 0 && len(handlers.OnSuccess) == 0 && len(handlers.OnError) == 0
+}
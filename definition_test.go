@@ -0,0 +1,73 @@
+package state_machine
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// roundTripDefinition declares every field of a definition, with the functions written as GetDefinition writes them
+const roundTripDefinition = `{
+	"name": "orders",
+	"before_transition": [{"func": "lock"}],
+	"after_transition": [{"func": "unlock", "ignore_error": true}],
+	"states": [
+		{"name": "open", "initial": true, "initial_child": "pending",
+			"create": {"check": [{"func": "canCreate(ADMIN)"}]},
+			"transitions": [{"name": "canceled", "event": "cancel", "on_error": [{"func": "alert", "ignore_no_success": true}]}]},
+		{"name": "pending", "parent": "open",
+			"on_enter": [{"func": "notify(pending)"}],
+			"on_exit": [{"func": "log"}],
+			"transitions": [
+				{"name": "paid", "event": "pay", "guard": "total > 0",
+					"retry": {"max": 3, "backoff": "exponential", "initial": "10ms"},
+					"check": [{"any": [{"func": "isPaid"}, {"not": {"func": "isBlocked"}}]}],
+					"on_success": [
+						{"func": "reserve", "adapter": "items", "filter": "inStock", "compensate": "release(stock)", "ignore_error": true},
+						{"func": "invoices(invoices, sent)", "is_state_machine": true, "compensate": "revert", "ignore_no_success": true}]},
+				{"name": "canceled", "after": "48h0m0s"}]},
+		{"name": "paid", "parent": "open"},
+		{"name": "canceled", "final": true},
+		{"name": "completed", "final": true}
+	],
+	"regions": [
+		{"name": "Payment", "states": [
+			{"name": "unpaid", "initial": true, "transitions": [{"name": "settled", "event": "settle"}]},
+			{"name": "settled", "transitions": [{"name": "completed", "join": [{"region": "shipping.eu", "state": "delivered"}]}]}]},
+		{"name": "shipping.eu", "states": [
+			{"name": "packing", "initial": true, "transitions": [{"name": "delivered"}]},
+			{"name": "delivered"}]}
+	]
+}`
+
+func TestMarshalDefinitionRoundTrip(t *testing.T) {
+	sm := NewStateMachine()
+	if err := sm.LoadFromBytes([]byte(roundTripDefinition), DefinitionFormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	var want Definition
+	if err := json.Unmarshal([]byte(roundTripDefinition), &want); err != nil {
+		t.Fatal(err)
+	}
+	if definition := sm.GetDefinition(); !reflect.DeepEqual(definition, want) {
+		t.Fatalf("GetDefinition() = %+v\nwant %+v", definition, want)
+	}
+
+	for _, format := range []string{DefinitionFormatJSON, DefinitionFormatYAML, DefinitionFormatTOML} {
+		t.Run(format, func(t *testing.T) {
+			data, err := sm.MarshalDefinition(format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			reloaded := NewStateMachine()
+			if err = reloaded.LoadFromBytes(data, format); err != nil {
+				t.Fatalf("load of the %s definition: %v\n%s", format, err, data)
+			}
+
+			if definition := reloaded.GetDefinition(); !reflect.DeepEqual(definition, want) {
+				t.Errorf("reloaded definition = %+v\nwant %+v\n%s", definition, want, data)
+			}
+		})
+	}
+}
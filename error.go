@@ -0,0 +1,365 @@
+package state_machine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrTransitionCanceled is returned when the context of a transition is done before the run finishes
+type ErrTransitionCanceled struct {
+	// Machine
+	Machine string
+	// State
+	State string
+	// Next State
+	NextState string
+	// Err is the context error (context.Canceled or context.DeadlineExceeded)
+	Err error
+}
+
+func (e *ErrTransitionCanceled) Error() string {
+	return fmt.Sprintf("transition from [%s] to [%s] of state machine [%s] canceled: %v", e.State, e.NextState, e.Machine, e.Err)
+}
+
+func (e *ErrTransitionCanceled) Is(target error) bool {
+	_, ok := target.(*ErrTransitionCanceled)
+	return ok
+}
+
+func (e *ErrTransitionCanceled) Unwrap() error {
+	return e.Err
+}
+
+// ErrFinalState is returned when a transition tries to leave a final state
+type ErrFinalState struct {
+	// Machine
+	Machine string
+	// State
+	State string
+	// Next State
+	NextState string
+	// Event fired instead of a next state
+	Event string
+}
+
+func (e *ErrFinalState) Error() string {
+	if e.Event != "" {
+		return fmt.Sprintf("state [%s] of state machine [%s] is final, can not fire event [%s]", e.State, e.Machine, e.Event)
+	}
+	return fmt.Sprintf("state [%s] of state machine [%s] is final, can not transition to [%s]", e.State, e.Machine, e.NextState)
+}
+
+// Is a transition leaving a final state is also not allowed
+func (e *ErrFinalState) Is(target error) bool {
+	switch target.(type) {
+	case *ErrFinalState, *ErrTransitionNotAllowed:
+		return true
+	}
+	return false
+}
+
+// ErrTransitionNotAllowed is returned when the transition is not defined in the current state
+type ErrTransitionNotAllowed struct {
+	// Machine
+	Machine string
+	// State
+	State string
+	// Next State
+	NextState string
+}
+
+func (e *ErrTransitionNotAllowed) Error() string {
+	return fmt.Sprintf("transition from [%s] to [%s] is not allowed in state machine [%s]", e.State, e.NextState, e.Machine)
+}
+
+func (e *ErrTransitionNotAllowed) Is(target error) bool {
+	_, ok := target.(*ErrTransitionNotAllowed)
+	return ok
+}
+
+// ErrEventNotAllowed is returned when the event has no transition from the current state
+type ErrEventNotAllowed struct {
+	// Machine
+	Machine string
+	// State
+	State string
+	// Event
+	Event string
+}
+
+func (e *ErrEventNotAllowed) Error() string {
+	return fmt.Sprintf("event [%s] is not allowed in state [%s] of state machine [%s]", e.Event, e.State, e.Machine)
+}
+
+// Is an event without a transition is also a transition not allowed
+func (e *ErrEventNotAllowed) Is(target error) bool {
+	switch target.(type) {
+	case *ErrEventNotAllowed, *ErrTransitionNotAllowed:
+		return true
+	}
+	return false
+}
+
+// ErrCheckRejected is returned when a check of the transition does not pass
+type ErrCheckRejected struct {
+	// Machine
+	Machine string
+	// State
+	State string
+	// Next State
+	NextState string
+	// Check that rejected the transition, the function or the all/any/not group
+	Check string
+	// Args of the check function
+	Args []string
+}
+
+func (e *ErrCheckRejected) Error() string {
+	return fmt.Sprintf("check [%s] rejected the transition from [%s] to [%s] of state machine [%s]", formatFunction(e.Check, e.Args), e.State, e.NextState, e.Machine)
+}
+
+func (e *ErrCheckRejected) Is(target error) bool {
+	_, ok := target.(*ErrCheckRejected)
+	return ok
+}
+
+// ErrHandlerNotRegistered is returned when a transition uses a handler that is not registered
+type ErrHandlerNotRegistered struct {
+	// Machine
+	Machine string
+	// Kind of the handler (check, on_success, adapter, execute, ...)
+	Kind string
+	// Name of the handler
+	Name string
+}
+
+func (e *ErrHandlerNotRegistered) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("%s function of state machine [%s] is not registered", e.Kind, e.Machine)
+	}
+	return fmt.Sprintf("%s [%s] of state machine [%s] is not registered", e.Kind, e.Name, e.Machine)
+}
+
+func (e *ErrHandlerNotRegistered) Is(target error) bool {
+	_, ok := target.(*ErrHandlerNotRegistered)
+	return ok
+}
+
+// ErrExecuteFailed is returned when the execute function fails
+type ErrExecuteFailed struct {
+	// Machine
+	Machine string
+	// State
+	State string
+	// Next State
+	NextState string
+	// Err returned by the execute function
+	Err error
+}
+
+func (e *ErrExecuteFailed) Error() string {
+	return fmt.Sprintf("execute of the transition from [%s] to [%s] of state machine [%s] failed: %v", e.State, e.NextState, e.Machine, e.Err)
+}
+
+func (e *ErrExecuteFailed) Is(target error) bool {
+	_, ok := target.(*ErrExecuteFailed)
+	return ok
+}
+
+func (e *ErrExecuteFailed) Unwrap() error {
+	return e.Err
+}
+
+// ErrConcurrentModification is returned when the object left the state read by the transition before it was written
+type ErrConcurrentModification struct {
+	// Machine
+	Machine string
+	// ObjectId of the object in the state store
+	ObjectId string
+	// State read by the transition
+	State string
+	// Next State
+	NextState string
+	// Version read by the transition
+	Version int64
+}
+
+func (e *ErrConcurrentModification) Error() string {
+	return fmt.Sprintf("object [%s] of state machine [%s] was modified concurrently, it is no longer in state [%s] at version %d to transition to [%s]", e.ObjectId, e.Machine, e.State, e.Version, e.NextState)
+}
+
+func (e *ErrConcurrentModification) Is(target error) bool {
+	_, ok := target.(*ErrConcurrentModification)
+	return ok
+}
+
+// fill sets the empty fields of a conflict reported by an execute function
+func (e *ErrConcurrentModification) fill(run *transitionRun) *ErrConcurrentModification {
+	if e.Machine == "" {
+		e.Machine = run.machine
+	}
+	if e.State == "" && e.NextState == "" {
+		e.State, e.NextState, e.Version = run.from, run.to, run.version
+	}
+
+	return e
+}
+
+// ErrChildMachineFailed is returned when a state machine triggered by the transition fails
+type ErrChildMachineFailed struct {
+	// Machine that failed
+	Machine string
+	// Path of the state machines from the one processing the transition to the one that failed
+	Path []string
+	// NextState of the failed state machine
+	NextState string
+	// Err returned by the failed state machine
+	Err error
+}
+
+func (e *ErrChildMachineFailed) Error() string {
+	return fmt.Sprintf("triggered state machine [%s] failed to transition to [%s] (%s): %v", e.Machine, e.NextState, strings.Join(e.Path, " -> "), e.Err)
+}
+
+func (e *ErrChildMachineFailed) Is(target error) bool {
+	_, ok := target.(*ErrChildMachineFailed)
+	return ok
+}
+
+func (e *ErrChildMachineFailed) Unwrap() error {
+	return e.Err
+}
+
+// ErrFrozen is returned (or raised, when registering handlers) when a frozen state machine is changed
+type ErrFrozen struct {
+	// Machine
+	Machine string
+}
+
+func (e *ErrFrozen) Error() string {
+	return fmt.Sprintf("state machine [%s] is frozen", e.Machine)
+}
+
+func (e *ErrFrozen) Is(target error) bool {
+	_, ok := target.(*ErrFrozen)
+	return ok
+}
+
+// ErrGuardRejected is returned when the guard of a transition does not pass
+type ErrGuardRejected struct {
+	// Machine
+	Machine string
+	// State
+	State string
+	// Next State
+	NextState string
+	// Guard
+	Guard string
+}
+
+func (e *ErrGuardRejected) Error() string {
+	return fmt.Sprintf("guard [%s] rejected the transition from [%s] to [%s] of state machine [%s]", e.Guard, e.State, e.NextState, e.Machine)
+}
+
+// Is a guard rejection is also a check rejection
+func (e *ErrGuardRejected) Is(target error) bool {
+	switch target.(type) {
+	case *ErrGuardRejected, *ErrCheckRejected:
+		return true
+	}
+	return false
+}
+
+// ErrUnexpectedObject is returned when a typed state machine receives an object of another type
+type ErrUnexpectedObject struct {
+	// Machine
+	Machine string
+	// Expected type
+	Expected string
+	// Got type
+	Got string
+}
+
+func (e *ErrUnexpectedObject) Error() string {
+	return fmt.Sprintf("state machine [%s] expects objects of type [%s], got [%s]", e.Machine, e.Expected, e.Got)
+}
+
+func (e *ErrUnexpectedObject) Is(target error) bool {
+	_, ok := target.(*ErrUnexpectedObject)
+	return ok
+}
+
+// ErrTransactionFailed is returned when the transaction of a transition can not begin, commit or roll back
+type ErrTransactionFailed struct {
+	// Machine
+	Machine string
+	// Op begin, commit or rollback
+	Op string
+	// Err
+	Err error
+}
+
+func (e *ErrTransactionFailed) Error() string {
+	return fmt.Sprintf("%s of the transaction of state machine [%s] failed: %v", e.Op, e.Machine, e.Err)
+}
+
+func (e *ErrTransactionFailed) Is(target error) bool {
+	_, ok := target.(*ErrTransactionFailed)
+	return ok
+}
+
+func (e *ErrTransactionFailed) Unwrap() error {
+	return e.Err
+}
+
+// ErrTransitionCompensated is returned when a transition fails after some of its on_success handlers
+// completed, and their compensations ran in reverse order
+type ErrTransitionCompensated struct {
+	// Machine
+	Machine string
+	// Err the failure of the transition, nil when a handler returned no success
+	Err error
+	// Compensations in the order they ran
+	Compensations []CompensationResult
+}
+
+func (e *ErrTransitionCompensated) Error() string {
+	results := make([]string, 0, len(e.Compensations))
+	for _, result := range e.Compensations {
+		status := "ok"
+		if !result.Success {
+			status = "failed"
+			if result.Err != nil {
+				status = fmt.Sprintf("failed: %v", result.Err)
+			}
+		}
+		results = append(results, fmt.Sprintf("%s/%s -> %s (%s)", result.Machine, result.Handler, result.Compensate, status))
+	}
+
+	cause := "a handler returned no success"
+	if e.Err != nil {
+		cause = e.Err.Error()
+	}
+
+	return fmt.Sprintf("transition of state machine [%s] compensated [%s] after: %s", e.Machine, strings.Join(results, ", "), cause)
+}
+
+func (e *ErrTransitionCompensated) Is(target error) bool {
+	_, ok := target.(*ErrTransitionCompensated)
+	return ok
+}
+
+func (e *ErrTransitionCompensated) Unwrap() error {
+	return e.Err
+}
+
+// Succeeded returns true when every compensation succeeded
+func (e *ErrTransitionCompensated) Succeeded() bool {
+	for _, result := range e.Compensations {
+		if !result.Success {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,53 @@
+package state_machine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestErrorsIs(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		target error
+	}{
+		{name: "transition canceled", err: &ErrTransitionCanceled{Err: context.Canceled}, target: &ErrTransitionCanceled{}},
+		{name: "transition canceled wraps the context error", err: &ErrTransitionCanceled{Err: context.Canceled}, target: context.Canceled},
+		{name: "final state", err: &ErrFinalState{}, target: &ErrFinalState{}},
+		{name: "final state is not allowed", err: &ErrFinalState{}, target: &ErrTransitionNotAllowed{}},
+		{name: "transition not allowed", err: &ErrTransitionNotAllowed{}, target: &ErrTransitionNotAllowed{}},
+		{name: "event not allowed", err: &ErrEventNotAllowed{}, target: &ErrTransitionNotAllowed{}},
+		{name: "check rejected", err: &ErrCheckRejected{}, target: &ErrCheckRejected{}},
+		{name: "guard rejected is a check rejection", err: &ErrGuardRejected{}, target: &ErrCheckRejected{}},
+		{name: "handler not registered", err: &ErrHandlerNotRegistered{}, target: &ErrHandlerNotRegistered{}},
+		{name: "execute failed", err: &ErrExecuteFailed{}, target: &ErrExecuteFailed{}},
+		{name: "concurrent modification", err: &ErrConcurrentModification{}, target: &ErrConcurrentModification{}},
+		{name: "child machine failed", err: &ErrChildMachineFailed{}, target: &ErrChildMachineFailed{}},
+		{name: "frozen", err: &ErrFrozen{}, target: &ErrFrozen{}},
+		{name: "unexpected object", err: &ErrUnexpectedObject{}, target: &ErrUnexpectedObject{}},
+		{name: "transaction failed", err: &ErrTransactionFailed{Err: errors.New("commit")}, target: &ErrTransactionFailed{}},
+		{name: "transition compensated", err: &ErrTransitionCompensated{}, target: &ErrTransitionCompensated{}},
+		{name: "expression", err: &ErrExpression{}, target: &ErrExpression{}},
+		{name: "validation", err: &ErrValidation{}, target: &ErrValidation{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if !errors.Is(test.err, test.target) {
+				t.Errorf("errors.Is(%T, %T) = false, want true", test.err, test.target)
+			}
+			if wrapped := fmt.Errorf("wrapped: %w", test.err); !errors.Is(wrapped, test.target) {
+				t.Errorf("errors.Is(wrapped %T, %T) = false, want true", test.err, test.target)
+			}
+			var unrelated error = &ErrFrozen{}
+			if _, frozen := test.err.(*ErrFrozen); frozen {
+				unrelated = &ErrExpression{}
+			}
+			if errors.Is(test.err, unrelated) {
+				t.Errorf("errors.Is(%T, %T) = true, want false", test.err, unrelated)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package state_machine
+
+import (
+	"context"
+)
+
+// TransitionEvaluation the result of the dry run of a transition
+type TransitionEvaluation struct {
+	// State the current state
+	State string `json:"state"`
+	// NextState
+	NextState string `json:"next_state"`
+	// Event of the transition
+	Event string `json:"event,omitempty"`
+	// Region of the transition, empty in the main region
+	Region string `json:"region,omitempty"`
+	// Allowed the transition is defined and its guard and checks pass
+	Allowed bool `json:"allowed"`
+	// Check that rejected the transition (the guard, a check function or a group of checks)
+	Check string `json:"check,omitempty"`
+	// Reason the rejection, an ErrTransitionNotAllowed, ErrCheckRejected, ... or the error of a check
+	Reason error `json:"-"`
+}
+
+// CanTransition evaluates the transition without side effects, only the current state function,
+// the join, the guard and the checks are run. Execute, the lifecycle hooks and the on_success and on_error handlers are not.
+func (sm *StateMachine) CanTransition(nextState string, obj any) (TransitionEvaluation, error) {
+	return sm.CanTransitionContext(context.Background(), nextState, obj)
+}
+
+func (sm *StateMachine) CanTransitionContext(ctx context.Context, nextState string, obj any) (TransitionEvaluation, error) {
+	vector, err := sm.evaluationVector(ctx, obj)
+	if err != nil {
+		return TransitionEvaluation{NextState: nextState}, err
+	}
+
+	return sm.evaluateTransition(ctx, vector, sm.RegionOf(nextState), nextState, obj)
+}
+
+// AvailableTransitions evaluates every transition of the current state without side effects, see CanTransition.
+// The transitions are in the declared order, the ones of the regions follow the ones of the main region.
+func (sm *StateMachine) AvailableTransitions(obj any) ([]TransitionEvaluation, error) {
+	return sm.AvailableTransitionsContext(context.Background(), obj)
+}
+
+func (sm *StateMachine) AvailableTransitionsContext(ctx context.Context, obj any) (evaluations []TransitionEvaluation, err error) {
+	vector, err := sm.evaluationVector(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, region := range sm.getRegions() {
+		currentState := vector[region]
+		if sm.IsFinalState(currentState) || (currentState == "" && region != MainRegion) {
+			continue
+		}
+
+		for _, nextState := range sm.getTransitions(currentState) {
+			evaluation, err := sm.evaluateTransition(ctx, vector, region, nextState, obj)
+			if err != nil {
+				return nil, err
+			}
+			evaluations = append(evaluations, evaluation)
+		}
+	}
+
+	return evaluations, nil
+}
+
+// evaluationVector gets the current state of the object for a dry run, in the main region without regions
+func (sm *StateMachine) evaluationVector(ctx context.Context, obj any) (StateVector, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, &ErrTransitionCanceled{Machine: sm.GetName(), Err: err}
+	}
+
+	if err := sm.ensureValidated(); err != nil {
+		return nil, err
+	}
+
+	if sm.hasRegions() {
+		vector, _, err := sm.readVector(ctx, obj)
+		return vector, err
+	}
+
+	currentState, _, err := sm.readState(ctx, obj)
+	return StateVector{MainRegion: currentState}, err
+}
+
+// evaluateTransition runs the join, the guard and the checks of a transition of a region,
+// only a canceled context is returned as an error, any other failure rejects the transition
+func (sm *StateMachine) evaluateTransition(ctx context.Context, vector StateVector, region, nextState string, obj any) (TransitionEvaluation, error) {
+	currentState := vector[region]
+	evaluation := TransitionEvaluation{State: currentState, NextState: nextState, Region: region}
+
+	if sm.IsFinalState(currentState) {
+		evaluation.Reason = &ErrFinalState{Machine: sm.GetName(), State: currentState, NextState: nextState}
+		return evaluation, nil
+	}
+
+	handlers, ok := sm.getHandlers(currentState, nextState)
+	if !ok {
+		evaluation.Reason = &ErrTransitionNotAllowed{Machine: sm.GetName(), State: currentState, NextState: nextState}
+		return evaluation, nil
+	}
+
+	evaluation.Event = handlers.Event
+	run := sm.newTransitionRun(ctx, currentState, nextState, obj)
+	run.fromVector = vector
+
+	success, err := sm.runJoin(run, handlers.Join)
+	if err == nil {
+		success, err = sm.runGuard(run, handlers.Guard, obj)
+	}
+	if err == nil {
+		success, err = sm.runCheckFunction(ctx, run, handlers.Check, obj)
+	}
+	if cancelErr := sm.canceled(ctx, currentState, nextState); cancelErr != nil {
+		return evaluation, cancelErr
+	}
+
+	evaluation.Allowed = success && err == nil
+	evaluation.Check = run.failedHandler
+	evaluation.Reason = err
+
+	return evaluation, nil
+}
+
+// getTransitions returns the next states of a state in the declared order, the remaining ones are sorted,
+// followed by the ones inherited from its ancestors
+func (sm *StateMachine) getTransitions(state string) (transitions []string) {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+
+	seen := make(map[string]bool)
+	for _, ancestor := range sm.lineage(state) {
+		for _, stateInput := range sm.States {
+			if stateInput.Name != ancestor {
+				continue
+			}
+			for _, transition := range stateInput.Transitions {
+				if _, ok := sm.MapStates[ancestor][transition.Name]; ok && !seen[transition.Name] {
+					seen[transition.Name] = true
+					transitions = append(transitions, transition.Name)
+				}
+			}
+		}
+
+		for _, transition := range sortedKeys(sm.MapStates[ancestor]) {
+			if !seen[transition] {
+				seen[transition] = true
+				transitions = append(transitions, transition)
+			}
+		}
+	}
+
+	return transitions
+}
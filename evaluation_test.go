@@ -0,0 +1,91 @@
+package state_machine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+	errStock := errors.New("stock unavailable")
+
+	var calls []string
+	audit := NewMemoryAuditSink()
+	sm := NewStateMachine(WithAuditSink(audit))
+	if err := sm.LoadFromBytes([]byte(`{"name":"orders",
+		"before_transition":[{"func":"lock"}],
+		"states":[
+			{"name":"pending","initial":true,"on_exit":[{"func":"leave"}],"transitions":[
+				{"name":"paid","event":"pay","check":[{"func":"isPaid"}],"on_success":[{"func":"notify"}],"on_error":[{"func":"alert"}]},
+				{"name":"canceled","guard":"total > 100","on_error":[{"func":"alert"}]},
+				{"name":"shipped","check":[{"func":"inStock","func_arg":["warehouse"]}],"on_error":[{"func":"alert"}]},
+				{"name":"refunded","check":[{"func":"isRefunded"}]}]},
+			{"name":"paid","final":true,"on_enter":[{"func":"enter"}]},
+			{"name":"canceled","final":true},
+			{"name":"shipped","final":true},
+			{"name":"refunded","final":true}]}`), "json"); err != nil {
+		t.Fatal(err)
+	}
+
+	record := func(name string, success bool, err error) HandlerFunc {
+		return func(any, ...string) (bool, error) {
+			calls = append(calls, name)
+			return success, err
+		}
+	}
+	sm.AddCurrentStateFunction(func(any) (string, error) { return "pending", nil })
+	sm.AddExecuteFunction(func(nextState string, _ any) error {
+		calls = append(calls, "execute "+nextState)
+		return nil
+	})
+	sm.AddCheckFunction("isPaid", record("isPaid", true, nil))
+	sm.AddCheckFunction("inStock", record("inStock", false, errStock))
+	sm.AddCheckFunction("isRefunded", record("isRefunded", false, nil))
+	for _, name := range []string{"lock", "leave", "notify", "enter"} {
+		sm.AddOnSuccessFunction(name, record(name, true, nil))
+	}
+	sm.AddOnErrorFunction("alert", record("alert", true, nil))
+
+	order := map[string]any{"total": 10}
+	want := []struct {
+		evaluation TransitionEvaluation
+		reason     error
+	}{
+		{evaluation: TransitionEvaluation{State: "pending", NextState: "paid", Event: "pay", Allowed: true}},
+		{evaluation: TransitionEvaluation{State: "pending", NextState: "canceled", Check: "guard"}, reason: &ErrGuardRejected{}},
+		{evaluation: TransitionEvaluation{State: "pending", NextState: "shipped", Check: "inStock"}, reason: errStock},
+		{evaluation: TransitionEvaluation{State: "pending", NextState: "refunded", Check: "isRefunded"}, reason: &ErrCheckRejected{}},
+	}
+
+	evaluations, err := sm.AvailableTransitions(order)
+	if err != nil || len(evaluations) != len(want) {
+		t.Fatalf("AvailableTransitions = %+v, %v, want %d evaluations", evaluations, err, len(want))
+	}
+	for i, evaluation := range evaluations {
+		reason := evaluation.Reason
+		evaluation.Reason = nil
+		if !reflect.DeepEqual(evaluation, want[i].evaluation) || (want[i].reason == nil) != (reason == nil) || (reason != nil && !errors.Is(reason, want[i].reason)) {
+			t.Errorf("evaluation %d = %+v, %v, want %+v, %v", i, evaluation, reason, want[i].evaluation, want[i].reason)
+		}
+
+		canTransition, err := sm.CanTransition(evaluation.NextState, order)
+		canTransition.Reason = nil
+		if err != nil || !reflect.DeepEqual(canTransition, evaluation) {
+			t.Errorf("CanTransition(%s) = %+v, %v, want %+v", evaluation.NextState, canTransition, err, evaluation)
+		}
+	}
+
+	evaluation, err := sm.CanTransition("unknown", order)
+	if err != nil || evaluation.Allowed || !errors.Is(evaluation.Reason, &ErrTransitionNotAllowed{}) {
+		t.Errorf("CanTransition(unknown) = %+v, %v, want an ErrTransitionNotAllowed", evaluation, err)
+	}
+
+	// only the checks ran, twice each
+	wantCalls := []string{"isPaid", "inStock", "isRefunded", "isPaid", "inStock", "isRefunded"}
+	if !reflect.DeepEqual(calls, wantCalls) {
+		t.Errorf("calls = %v, want %v", calls, wantCalls)
+	}
+	if records := audit.Records(); len(records) != 0 {
+		t.Errorf("audit records = %+v, want none", records)
+	}
+}
@@ -0,0 +1,85 @@
+package state_machine
+
+import (
+	"context"
+)
+
+// Fire processes the transition of the event from the current state of the object,
+// so the callers don't depend on the names of the target states
+func (sm *StateMachine) Fire(event string, obj any) (success bool, err error) {
+	return sm.FireContext(context.Background(), event, obj)
+}
+
+// FireContext processes the transition of the event from the current state of the object, see ProcessTransitionContext.
+// An event without a transition from the current state fails with an ErrEventNotAllowed. With regions, the event
+// fires in the first region, main region first then in the declared order, whose current state has a transition for it.
+func (sm *StateMachine) FireContext(ctx context.Context, event string, obj any) (success bool, err error) {
+	return sm.processTransitionWithRetry(ctx, transitionRequest{event: event}, obj)
+}
+
+// CanFire evaluates the transition of the event without side effects, see CanTransition
+func (sm *StateMachine) CanFire(event string, obj any) (TransitionEvaluation, error) {
+	return sm.CanFireContext(context.Background(), event, obj)
+}
+
+func (sm *StateMachine) CanFireContext(ctx context.Context, event string, obj any) (TransitionEvaluation, error) {
+	vector, err := sm.evaluationVector(ctx, obj)
+	if err != nil {
+		return TransitionEvaluation{Event: event}, err
+	}
+
+	region := MainRegion
+	for _, candidate := range sm.getRegions() {
+		if _, ok := sm.getEventTarget(vector[candidate], event); ok {
+			region = candidate
+			break
+		}
+	}
+	currentState := vector[region]
+
+	if sm.IsFinalState(currentState) {
+		return TransitionEvaluation{
+			State:  currentState,
+			Event:  event,
+			Reason: &ErrFinalState{Machine: sm.GetName(), State: currentState, Event: event},
+		}, nil
+	}
+
+	nextState, ok := sm.getEventTarget(currentState, event)
+	if !ok {
+		return TransitionEvaluation{
+			State:  currentState,
+			Event:  event,
+			Reason: &ErrEventNotAllowed{Machine: sm.GetName(), State: currentState, Event: event},
+		}, nil
+	}
+
+	return sm.evaluateTransition(ctx, vector, region, nextState, obj)
+}
+
+// Events returns the events of the transitions of a state, including the ones inherited from its ancestors, sorted
+func (sm *StateMachine) Events(state string) []string {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+
+	events := make(map[string]bool)
+	for _, ancestor := range sm.lineage(state) {
+		for event := range sm.events[ancestor] {
+			events[event] = true
+		}
+	}
+
+	return sortedKeys(events)
+}
+
+// getEventTarget returns the next state of the event in the state, or in its nearest ancestor
+func (sm *StateMachine) getEventTarget(state, event string) (string, bool) {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	for _, ancestor := range sm.lineage(state) {
+		if nextState, ok := sm.events[ancestor][event]; ok {
+			return nextState, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,101 @@
+package state_machine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFire(t *testing.T) {
+	tests := []struct {
+		name          string
+		state         string
+		event         string
+		total         int
+		wantNextState string
+		wantErr       error
+	}{
+		{name: "event of the state", state: "pending", event: "pay", total: 10, wantNextState: "paid"},
+		{name: "event of the parent", state: "reviewing", event: "pay", total: 10, wantNextState: "paid"},
+		{name: "event of the state before the one of the parent", state: "reviewing", event: "cancel", total: 10, wantNextState: "rejected"},
+		{name: "unknown event", state: "pending", event: "ship", wantErr: &ErrEventNotAllowed{}},
+		{name: "event of another state", state: "paid", event: "pay", wantErr: &ErrEventNotAllowed{}},
+		{name: "event rejected by its guard", state: "pending", event: "cancel", total: 200, wantErr: &ErrGuardRejected{}},
+		{name: "event in a final state", state: "canceled", event: "pay", wantErr: &ErrFinalState{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sm := NewStateMachine()
+			if err := sm.LoadFromBytes([]byte(`{"name":"orders","states":[
+				{"name":"pending","initial":true,"transitions":[
+					{"name":"paid","event":"pay","guard":"total > 0"},
+					{"name":"canceled","event":"cancel","guard":"total < 100"}]},
+				{"name":"reviewing","parent":"pending","transitions":[{"name":"rejected","event":"cancel"}]},
+				{"name":"paid","transitions":[{"name":"shipped","event":"ship"}]},
+				{"name":"rejected","final":true},
+				{"name":"canceled","final":true},
+				{"name":"shipped","final":true}]}`), "json"); err != nil {
+				t.Fatal(err)
+			}
+
+			var executed string
+			sm.AddCurrentStateFunction(func(any) (string, error) { return test.state, nil })
+			sm.AddExecuteFunction(func(nextState string, _ any) error {
+				executed = nextState
+				return nil
+			})
+			order := map[string]any{"total": test.total}
+
+			evaluation, err := sm.CanFire(test.event, order)
+			if err != nil || evaluation.Event != test.event || evaluation.Allowed != (test.wantErr == nil) ||
+				(test.wantErr == nil && evaluation.NextState != test.wantNextState) ||
+				(test.wantErr != nil && !errors.Is(evaluation.Reason, test.wantErr)) {
+				t.Errorf("CanFire = %+v, %v, want %s, %T", evaluation, err, test.wantNextState, test.wantErr)
+			}
+
+			success, err := sm.Fire(test.event, order)
+			if success != (test.wantErr == nil) || (test.wantErr == nil) != (err == nil) || (test.wantErr != nil && !errors.Is(err, test.wantErr)) {
+				t.Errorf("Fire = %v, %v, want %T", success, err, test.wantErr)
+			}
+			if executed != test.wantNextState {
+				t.Errorf("executed transition to %q, want %q", executed, test.wantNextState)
+			}
+			if test.wantErr != nil && !errors.Is(err, &ErrTransitionNotAllowed{}) && !errors.Is(err, &ErrGuardRejected{}) {
+				t.Errorf("Fire = %v, want an error matching ErrTransitionNotAllowed", err)
+			}
+		})
+	}
+}
+
+func TestAmbiguousEvent(t *testing.T) {
+	sm := NewStateMachine()
+	err := sm.LoadFromBytes([]byte(`{"name":"orders","states":[
+		{"name":"pending","initial":true,"transitions":[
+			{"name":"paid","event":"pay"},
+			{"name":"canceled","event":"pay"}]},
+		{"name":"paid","final":true},
+		{"name":"canceled","final":true}]}`), "json")
+	if err == nil || !strings.Contains(err.Error(), "event [pay] of state [pending] targets both [paid] and [canceled]") {
+		t.Errorf("LoadFromBytes = %v, want the ambiguous event rejected", err)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	sm := NewStateMachine()
+	if err := sm.LoadFromBytes([]byte(`{"name":"orders","states":[
+		{"name":"pending","initial":true,"transitions":[{"name":"paid","event":"pay"},{"name":"canceled","event":"cancel"}]},
+		{"name":"reviewing","parent":"pending","transitions":[{"name":"rejected","event":"reject"}]},
+		{"name":"paid","final":true},
+		{"name":"canceled","final":true},
+		{"name":"rejected","final":true}]}`), "json"); err != nil {
+		t.Fatal(err)
+	}
+
+	if events := strings.Join(sm.Events("reviewing"), ","); events != "cancel,pay,reject" {
+		t.Errorf("Events(reviewing) = %s, want cancel,pay,reject", events)
+	}
+	if events := sm.Events("paid"); len(events) != 0 {
+		t.Errorf("Events(paid) = %v, want none", events)
+	}
+}
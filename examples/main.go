@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+
 	"github.com/gocraft/dbr/v2"
 	_ "github.com/lib/pq"
-	state_machine "state-machine"
+
+	state_machine "github.com/guilhermealegre/state-machine"
 )
 
 func main() {
@@ -27,37 +30,60 @@ func main() {
 
 	defer tx.RollbackUnlessCommitted()
 
-	// state machine 1
-	sm1 := state_machine.NewStateMachine()
+	// state machine 1, the order
+	sm1 := state_machine.NewTyped[*ObjStateMachine](state_machine.WithValidation())
 	err = sm1.Load("examples/state-machine-2.json")
 	if err != nil {
 		fmt.Println("Error parsing state machine:", err)
 		return
 	}
+	sm1.AddCurrentStateFunction(CurrentStatusOrder)
 	sm1.AddExecuteFunction(UpdateStatusOrder)
 	sm1.AddCheckFunction("auth", Auth)
 	sm1.AddOnErrorFunction("trigger_error", TriggerError)
 
-	// state machine 2
-	sm2 := state_machine.NewStateMachine()
+	// state machine 2, the product of the order, triggered by the state machine 1
+	sm2 := state_machine.NewTyped[*ObjStateMachine](state_machine.WithValidation())
 	err = sm2.Load("examples/state-machine-1.json")
 	if err != nil {
 		fmt.Println("Error parsing state machine:", err)
 		return
 	}
+	sm2.AddCurrentStateFunction(CurrentStatusOrderItem)
 	sm2.AddExecuteFunction(UpdateStatusOrderItem)
-	sm1.AddStateMachineToTrigger(sm2)
+	sm1.AddStateMachineToTrigger(sm2.GetName(), sm2)
+
+	if err = sm1.Validate(); err != nil {
+		fmt.Println("Invalid state machine:", err)
+		return
+	}
 
 	// state machine
-	obj := ObjStateMachine{
+	obj := &ObjStateMachine{
 		Tx:            tx,
 		Authorization: []string{"AUTH_1"},
 		IdOrder:       1,
 		IdProduct:     1,
 	}
-	err = sm1.ProcessTransition("being-processed", "ready-for-pickup", obj)
+
+	// a failed transition returns false and its error, even when its on_error handlers succeed
+	success, err := sm1.ProcessTransition("state2", obj)
+	var rejected *state_machine.ErrCheckRejected
+	switch {
+	case errors.As(err, &rejected):
+		fmt.Printf("transition rejected by the check [%s]\n", rejected.Check)
+		return
+	case err != nil:
+		fmt.Println("Error processing the transition:", err)
+		return
+	case !success:
+		fmt.Println("transition not processed")
+		return
+	}
+
 	if err := tx.Commit(); err != nil {
 		fmt.Println("Commit error")
+		return
 	}
 
 	fmt.Println("state machine change successful the state")
@@ -71,58 +97,70 @@ type ObjStateMachine struct {
 	IdOrder       int      `json:"id_order"`
 }
 
-func UpdateStatusOrder(currentState, nextState string, obj any) (bool, error) {
-	smObj := obj.(ObjStateMachine)
+func CurrentStatusOrder(ctx context.Context, smObj *ObjStateMachine) (string, error) {
+	var status string
 
+	err := smObj.Tx.Select("s.key").
+		From(dbr.I("test.order").As("o")).
+		Join(dbr.I("test.status").As("s"), "s.id_status = o.fk_status").
+		Where("o.id_order = ?", smObj.IdOrder).
+		LoadOneContext(ctx, &status)
+
+	return status, err
+}
+
+func UpdateStatusOrder(ctx context.Context, nextState string, smObj *ObjStateMachine) error {
 	var fkStatusNexState int
 
 	_, err := smObj.Tx.Select("id_status").
 		From("test.status").
 		Where("key = ?", nextState).
-		Load(&fkStatusNexState)
+		LoadContext(ctx, &fkStatusNexState)
 	if err != nil {
-		return false, err
+		return err
 	}
 
 	_, err = smObj.Tx.Update("test.order").
 		Set("fk_status", fkStatusNexState).
 		Where("id_order = ?", smObj.IdOrder).
-		Exec()
-
-	if err != nil {
-		return false, err
-	}
+		ExecContext(ctx)
 
-	return true, nil
+	return err
 }
 
-func UpdateStatusOrderItem(currentState, nextState string, obj any) (bool, error) {
-	smObj := obj.(ObjStateMachine)
+func CurrentStatusOrderItem(ctx context.Context, smObj *ObjStateMachine) (string, error) {
+	var status string
 
+	err := smObj.Tx.Select("s.key").
+		From(dbr.I("test.product").As("p")).
+		Join(dbr.I("test.status").As("s"), "s.id_status = p.fk_status").
+		Where("p.id_product = ?", smObj.IdProduct).
+		LoadOneContext(ctx, &status)
+
+	return status, err
+}
+
+func UpdateStatusOrderItem(ctx context.Context, nextState string, smObj *ObjStateMachine) error {
 	var fkStatusNexState int
 
 	_, err := smObj.Tx.Select("id_status").
 		From("test.status").
 		Where("key = ?", nextState).
-		Load(&fkStatusNexState)
+		LoadContext(ctx, &fkStatusNexState)
 	if err != nil {
-		return false, err
+		return err
 	}
 
 	_, err = smObj.Tx.Update("test.product").
 		Set("fk_status", fkStatusNexState).
 		Where("id_product = ?", smObj.IdProduct).
-		Exec()
-
-	if err != nil {
-		return false, err
-	}
+		ExecContext(ctx)
 
-	return true, nil
+	return err
 }
 
-func Auth(obj any, input ...string) (bool, error) {
-	smObj := obj.(ObjStateMachine)
+// Auth rejects the transition when the object has none of the authorizations
+func Auth(_ context.Context, smObj *ObjStateMachine, input ...string) (bool, error) {
 	for _, in := range input {
 		for _, userAuth := range smObj.Authorization {
 			if userAuth == in {
@@ -131,10 +169,11 @@ func Auth(obj any, input ...string) (bool, error) {
 		}
 	}
 
-	return false, errors.New("don't have authorization")
+	return false, nil
 }
 
-func TriggerError(obj any, input ...string) (bool, error) {
+// TriggerError runs when the transition fails, its result does not change the result of the transition
+func TriggerError(_ context.Context, _ *ObjStateMachine, _ ...string) (bool, error) {
 	return true, errors.New("error in x")
 }
 
@@ -171,7 +210,7 @@ func createTableAndToTest(session *dbr.Session, migration bool) {
 			panic(err.Error())
 		}
 
-		stats := []string{"being-processed", "ready-for-pickup", "ready-for-shipment", "cancel"}
+		stats := []string{"state1", "state2", "state3", "state4", "state-4", "state5"}
 
 		for _, s := range stats {
 			_, err = session.InsertInto("test.status").
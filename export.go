@@ -0,0 +1,365 @@
+package state_machine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ToDOT renders the state machine as a graphviz DOT graph
+func (sm *StateMachine) ToDOT() string {
+	return ExportDOT(sm)
+}
+
+// ToMermaid renders the state machine as a mermaid stateDiagram-v2
+func (sm *StateMachine) ToMermaid() string {
+	return ExportMermaid(sm)
+}
+
+// ExportDOT renders several state machines, untyped or typed, in a single graphviz DOT graph.
+// The is_state_machine triggers between the exported machines are rendered as dashed edges.
+func ExportDOT(exported ...AnyStateMachine) string {
+	machines := exportMachines(exported)
+
+	var b strings.Builder
+	b.WriteString("digraph \"state_machines\" {\n")
+	b.WriteString("\trankdir=LR;\n")
+
+	for i, sm := range machines {
+		sm.mux.RLock()
+		b.WriteString(fmt.Sprintf("\tsubgraph \"cluster_%d\" {\n", i))
+		b.WriteString(fmt.Sprintf("\t\tlabel=%s;\n", dotQuote(sm.Name)))
+
+		for _, state := range exportStates(sm) {
+			attributes := []string{"label=" + dotQuote(state)}
+			if sm.finalStates[state] {
+				attributes = append(attributes, "shape=doublecircle")
+			} else {
+				attributes = append(attributes, "shape=circle")
+			}
+			if _, declared := sm.MapStates[state]; !declared {
+				attributes = append(attributes, "style=dashed")
+			}
+			b.WriteString(fmt.Sprintf("\t\t%s [%s];\n", dotQuote(exportNodeId(sm.Name, state)), strings.Join(attributes, ", ")))
+		}
+
+		if sm.initialState != "" {
+			start := dotQuote(exportNodeId(sm.Name, ""))
+			b.WriteString(fmt.Sprintf("\t\t%s [shape=point];\n", start))
+			b.WriteString(fmt.Sprintf("\t\t%s -> %s%s;\n", start, dotQuote(exportNodeId(sm.Name, sm.initialState)), dotEdgeLabel(sm.initialHandlers)))
+		}
+
+		for _, state := range sortedKeys(sm.MapStates) {
+			for _, transition := range sortedKeys(sm.MapStates[state]) {
+				b.WriteString(fmt.Sprintf("\t\t%s -> %s%s;\n",
+					dotQuote(exportNodeId(sm.Name, state)),
+					dotQuote(exportNodeId(sm.Name, transition)),
+					dotEdgeLabel(sm.MapStates[state][transition])))
+			}
+		}
+
+		b.WriteString("\t}\n")
+		sm.mux.RUnlock()
+	}
+
+	for _, link := range exportTriggerLinks(machines) {
+		b.WriteString(fmt.Sprintf("\t%s -> %s [style=dashed, label=%s];\n",
+			dotQuote(exportNodeId(link.from, link.fromState)),
+			dotQuote(exportNodeId(link.to, link.toState)),
+			dotQuote("trigger "+link.to)))
+	}
+
+	b.WriteString("}\n")
+
+	return b.String()
+}
+
+// ExportMermaid renders several state machines, untyped or typed, in a single mermaid stateDiagram-v2.
+// Each machine is a composite state and the is_state_machine triggers between the
+// exported machines are rendered as transitions between them.
+func ExportMermaid(exported ...AnyStateMachine) string {
+	machines := exportMachines(exported)
+
+	var b strings.Builder
+	b.WriteString("stateDiagram-v2\n")
+
+	ids := make(map[string]string)
+	mermaidId := func(machine string, state string) string {
+		key := exportNodeId(machine, state)
+		if id, ok := ids[key]; ok {
+			return id
+		}
+		id := fmt.Sprintf("s%d", len(ids))
+		ids[key] = id
+		return id
+	}
+
+	for i, sm := range machines {
+		sm.mux.RLock()
+		indent := "\t"
+		if len(machines) > 1 {
+			b.WriteString(fmt.Sprintf("\tstate %s as m%d {\n", mermaidQuote(sm.Name), i))
+			indent = "\t\t"
+		}
+
+		for _, state := range exportStates(sm) {
+			b.WriteString(fmt.Sprintf("%sstate %s as %s\n", indent, mermaidQuote(state), mermaidId(sm.Name, state)))
+		}
+
+		if sm.initialState != "" {
+			b.WriteString(fmt.Sprintf("%s[*] --> %s%s\n", indent, mermaidId(sm.Name, sm.initialState), mermaidEdgeLabel(sm.initialHandlers)))
+		}
+
+		for _, state := range sortedKeys(sm.MapStates) {
+			for _, transition := range sortedKeys(sm.MapStates[state]) {
+				b.WriteString(fmt.Sprintf("%s%s --> %s%s\n", indent,
+					mermaidId(sm.Name, state),
+					mermaidId(sm.Name, transition),
+					mermaidEdgeLabel(sm.MapStates[state][transition])))
+			}
+		}
+
+		for _, state := range sortedKeys(sm.finalStates) {
+			b.WriteString(fmt.Sprintf("%s%s --> [*]\n", indent, mermaidId(sm.Name, state)))
+		}
+
+		if len(machines) > 1 {
+			b.WriteString("\t}\n")
+		}
+		sm.mux.RUnlock()
+	}
+
+	for _, link := range exportTriggerLinks(machines) {
+		b.WriteString(fmt.Sprintf("\t%s --> %s : trigger %s\n",
+			mermaidId(link.from, link.fromState),
+			mermaidId(link.to, link.toState),
+			mermaidLabel(link.to)))
+	}
+
+	return b.String()
+}
+
+// triggerLink an is_state_machine trigger between two exported machines
+type triggerLink struct {
+	from      string
+	fromState string
+	to        string
+	toState   string
+}
+
+// triggerReference an is_state_machine trigger declared in a transition
+type triggerReference struct {
+	fromState string
+	trigger   IStateMachine
+	toState   string
+}
+
+// exportMachines unwraps the exported state machines, the other implementations of IStateMachine are skipped
+func exportMachines(exported []AnyStateMachine) (machines []*StateMachine) {
+	for _, machine := range exported {
+		if sm, ok := machine.Untyped().(*StateMachine); ok {
+			machines = append(machines, sm)
+		}
+	}
+
+	return machines
+}
+
+// exportTriggerLinks collects the triggers whose target machine is also being exported
+func exportTriggerLinks(machines []*StateMachine) (links []triggerLink) {
+	for _, sm := range machines {
+		sm.mux.RLock()
+		var references []triggerReference
+		if sm.initialState != "" {
+			references = append(references, exportTriggerReferences(sm, sm.initialState, sm.initialHandlers)...)
+		}
+
+		for _, state := range sortedKeys(sm.MapStates) {
+			for _, transition := range sortedKeys(sm.MapStates[state]) {
+				references = append(references, exportTriggerReferences(sm, transition, sm.MapStates[state][transition])...)
+			}
+		}
+		sm.mux.RUnlock()
+
+		// the names are resolved without holding the lock as the trigger can be the machine itself
+		for _, reference := range references {
+			name := reference.trigger.GetName()
+			for _, target := range machines {
+				if target.GetName() == name {
+					links = append(links, triggerLink{
+						from:      sm.GetName(),
+						fromState: reference.fromState,
+						to:        name,
+						toState:   reference.toState,
+					})
+				}
+			}
+		}
+	}
+
+	return links
+}
+
+// exportTriggerReferences collects the triggers of a transition, the caller must hold the lock
+func exportTriggerReferences(sm *StateMachine, nextState string, handlers Handlers) (references []triggerReference) {
+	for _, onSuccess := range handlers.OnSuccess {
+		if !onSuccess.IsStateMachine || len(onSuccess.FuncArg) < 2 {
+			continue
+		}
+
+		trigger := sm.stateMachinesToTriggerMap[onSuccess.Func]
+		if trigger == nil {
+			continue
+		}
+
+		references = append(references, triggerReference{
+			fromState: nextState,
+			trigger:   trigger,
+			toState:   onSuccess.FuncArg[1],
+		})
+	}
+
+	return references
+}
+
+// exportStates returns the declared states followed by the undeclared transition targets
+func exportStates(sm *StateMachine) []string {
+	states := sortedKeys(sm.MapStates)
+	seen := make(map[string]bool)
+	for _, state := range states {
+		seen[state] = true
+	}
+
+	for _, state := range sortedKeys(sm.MapStates) {
+		for _, transition := range sortedKeys(sm.MapStates[state]) {
+			if !seen[transition] {
+				seen[transition] = true
+				states = append(states, transition)
+			}
+		}
+	}
+
+	return states
+}
+
+func exportNodeId(machine string, state string) string {
+	if state == "" {
+		return machine + "/[*]"
+	}
+
+	return machine + "/" + state
+}
+
+// exportLabelLines describes the guard, the checks and the on_success side effects of a transition
+func exportLabelLines(handlers Handlers) (lines []string) {
+	if handlers.Event != "" {
+		lines = append(lines, handlers.Event)
+	}
+
+	if handlers.Join != nil {
+		lines = append(lines, "join: "+formatJoin(handlers.Join))
+	}
+
+	if handlers.After > 0 {
+		lines = append(lines, "after: "+handlers.After.String())
+	}
+
+	if handlers.Guard != nil {
+		lines = append(lines, "guard: "+handlers.Guard.String())
+	}
+
+	if len(handlers.Check) > 0 {
+		checks := make([]string, 0, len(handlers.Check))
+		for _, check := range handlers.Check {
+			checks = append(checks, formatCheck(check))
+		}
+		lines = append(lines, "check: "+strings.Join(checks, ", "))
+	}
+
+	if len(handlers.OnSuccess) > 0 {
+		onSuccess := make([]string, 0, len(handlers.OnSuccess))
+		for _, handler := range handlers.OnSuccess {
+			if handler.IsStateMachine {
+				onSuccess = append(onSuccess, "trigger "+formatFunction(handler.Func, handler.FuncArg))
+				continue
+			}
+			onSuccess = append(onSuccess, formatFunction(handler.Func, handler.FuncArg))
+		}
+		lines = append(lines, "on_success: "+strings.Join(onSuccess, ", "))
+	}
+
+	return lines
+}
+
+// formatCheck formats a check or a group of checks, e.g. any(isAdmin, not(isBlocked))
+func formatCheck(check CheckStruct) string {
+	switch {
+	case check.Not != nil:
+		return "not(" + formatCheck(*check.Not) + ")"
+	case len(check.Any) > 0 || len(check.All) > 0:
+		name, items := "all", check.All
+		if len(check.Any) > 0 {
+			name, items = "any", check.Any
+		}
+
+		parts := make([]string, 0, len(items))
+		for _, item := range items {
+			parts = append(parts, formatCheck(item))
+		}
+		return name + "(" + strings.Join(parts, ", ") + ")"
+	}
+
+	return formatFunction(check.Func, check.FuncArg)
+}
+
+// formatFunction formats a function and its arguments as written in the definition
+func formatFunction(name string, args []string) string {
+	if len(args) == 0 {
+		return name
+	}
+
+	return name + "(" + strings.Join(args, ", ") + ")"
+}
+
+func dotEdgeLabel(handlers Handlers) string {
+	lines := exportLabelLines(handlers)
+	if len(lines) == 0 {
+		return ""
+	}
+
+	return " [label=" + dotQuote(strings.Join(lines, "\n")) + "]"
+}
+
+func dotQuote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+
+	return `"` + value + `"`
+}
+
+func mermaidEdgeLabel(handlers Handlers) string {
+	lines := exportLabelLines(handlers)
+	if len(lines) == 0 {
+		return ""
+	}
+
+	for i, line := range lines {
+		lines[i] = mermaidLabel(line)
+	}
+
+	return " : " + strings.Join(lines, "<br/>")
+}
+
+func mermaidLabel(value string) string {
+	value = strings.ReplaceAll(value, ";", "#59;")
+	value = strings.ReplaceAll(value, ":", "#58;")
+	value = strings.ReplaceAll(value, "<", "#lt;")
+	value = strings.ReplaceAll(value, ">", "#gt;")
+	value = strings.ReplaceAll(value, "\n", " ")
+
+	return value
+}
+
+func mermaidQuote(value string) string {
+	return `"` + strings.ReplaceAll(value, `"`, "#quot;") + `"`
+}
@@ -0,0 +1,59 @@
+package state_machine
+
+import (
+	"strings"
+	"testing"
+)
+
+type exportInvoice struct{}
+
+func TestExportMachines(t *testing.T) {
+	invoices := NewTyped[exportInvoice]()
+	if err := invoices.LoadFromBytes([]byte(`{"name":"invoices","states":[
+		{"name":"draft","initial":true,"transitions":[{"name":"sent"}]},
+		{"name":"sent","final":true}]}`), "json"); err != nil {
+		t.Fatal(err)
+	}
+
+	orders := NewStateMachine()
+	orders.AddStateMachineToTrigger("invoices", invoices.Untyped())
+	if err := orders.LoadFromBytes([]byte(`{"name":"orders","states":[
+		{"name":"pending","initial":true,"transitions":[{"name":"paid","check":[{"func":"isPaid"}],"on_success":[{"func":"invoices","func_arg":["invoices","sent"],"is_state_machine":true}]}]},
+		{"name":"paid","final":true}]}`), "json"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		export func(...AnyStateMachine) string
+		want   []string
+	}{
+		{
+			name:   "dot",
+			export: ExportDOT,
+			want: []string{
+				`"orders/paid" -> "invoices/sent" [style=dashed, label="trigger invoices"];`,
+				`label="check: isPaid\non_success: trigger invoices(invoices, sent)"`,
+			},
+		},
+		{
+			name:   "mermaid",
+			export: ExportMermaid,
+			want: []string{
+				"check#58; isPaid<br/>on_success#58; trigger invoices(invoices, sent)",
+				"trigger invoices",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			exported := test.export(orders, invoices)
+			for _, want := range test.want {
+				if !strings.Contains(exported, want) {
+					t.Errorf("export does not contain %q:\n%s", want, exported)
+				}
+			}
+		})
+	}
+}
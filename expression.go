@@ -0,0 +1,902 @@
+package state_machine
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maxExpressionLength the maximum length of a guard expression
+const maxExpressionLength = 4096
+
+// ErrExpression is returned when a guard expression can not be parsed or evaluated
+type ErrExpression struct {
+	// Expr the expression
+	Expr string
+	// Pos the position (0 based offset) where the error was found
+	Pos int
+	// Msg
+	Msg string
+}
+
+func (e *ErrExpression) Error() string {
+	return fmt.Sprintf("expression [%s] at position %d: %s", e.Expr, e.Pos, e.Msg)
+}
+
+func (e *ErrExpression) Is(target error) bool {
+	_, ok := target.(*ErrExpression)
+	return ok
+}
+
+// Expression a compiled guard expression
+//
+// The language supports literals (numbers, 'strings', "strings", true, false, nil, [lists]),
+// fields of the object (total, customer.country, items[0]), the operators
+// || && ! == != < <= > >= in + - * / % and the functions len, lower and upper.
+type Expression struct {
+	source string
+	root   expressionNode
+}
+
+// CompileExpression compiles a guard expression
+func CompileExpression(source string) (*Expression, error) {
+	if len(source) > maxExpressionLength {
+		return nil, &ErrExpression{Expr: source, Msg: fmt.Sprintf("expression longer than %d characters", maxExpressionLength)}
+	}
+
+	tokens, err := lexExpression(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &expressionParser{source: source, tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if token := p.peek(); token.kind != tokenEOF {
+		return nil, p.errorf(token.pos, "unexpected %q", token.text)
+	}
+
+	return &Expression{source: source, root: root}, nil
+}
+
+// String returns the source of the expression
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Eval evaluates the expression against the object (a struct, a pointer to a struct or a map)
+func (e *Expression) Eval(obj any) (any, error) {
+	return e.root.eval(&expressionEnv{source: e.source, root: obj})
+}
+
+// EvalBool evaluates the expression, that must result in a boolean
+func (e *Expression) EvalBool(obj any) (bool, error) {
+	value, err := e.Eval(obj)
+	if err != nil {
+		return false, err
+	}
+
+	result, ok := value.(bool)
+	if !ok {
+		return false, &ErrExpression{Expr: e.source, Pos: e.root.position(), Msg: fmt.Sprintf("expected a boolean result, got %s", describeValue(value))}
+	}
+
+	return result, nil
+}
+
+// lexer
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOperator
+)
+
+type expressionToken struct {
+	kind  tokenKind
+	text  string
+	value any
+	pos   int
+}
+
+var expressionOperators = []string{"||", "&&", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", "[", "]", ",", "."}
+
+func lexExpression(source string) (tokens []expressionToken, err error) {
+	runes := []rune(source)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, expressionToken{kind: tokenIdent, text: string(runes[start:i]), pos: start})
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.' || runes[i] == '_') {
+				i++
+			}
+			text := string(runes[start:i])
+			number, parseErr := strconv.ParseFloat(strings.ReplaceAll(text, "_", ""), 64)
+			if parseErr != nil {
+				return nil, &ErrExpression{Expr: source, Pos: start, Msg: fmt.Sprintf("invalid number %q", text)}
+			}
+			tokens = append(tokens, expressionToken{kind: tokenNumber, text: text, value: number, pos: start})
+		case r == '\'' || r == '"':
+			start := i
+			var b strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != r; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				b.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, &ErrExpression{Expr: source, Pos: start, Msg: "unterminated string"}
+			}
+			i++
+			tokens = append(tokens, expressionToken{kind: tokenString, text: string(runes[start:i]), value: b.String(), pos: start})
+		default:
+			matched := false
+			for _, operator := range expressionOperators {
+				if strings.HasPrefix(string(runes[i:]), operator) {
+					tokens = append(tokens, expressionToken{kind: tokenOperator, text: operator, pos: i})
+					i += len([]rune(operator))
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, &ErrExpression{Expr: source, Pos: i, Msg: fmt.Sprintf("unexpected character %q", r)}
+			}
+		}
+	}
+
+	return append(tokens, expressionToken{kind: tokenEOF, text: "end of expression", pos: len(runes)}), nil
+}
+
+// parser
+
+type expressionParser struct {
+	source string
+	tokens []expressionToken
+	index  int
+}
+
+func (p *expressionParser) peek() expressionToken {
+	return p.tokens[p.index]
+}
+
+func (p *expressionParser) next() expressionToken {
+	token := p.tokens[p.index]
+	if token.kind != tokenEOF {
+		p.index++
+	}
+	return token
+}
+
+func (p *expressionParser) accept(texts ...string) (expressionToken, bool) {
+	token := p.peek()
+	if token.kind != tokenOperator && token.kind != tokenIdent {
+		return token, false
+	}
+
+	for _, text := range texts {
+		if token.text == text {
+			p.index++
+			return token, true
+		}
+	}
+
+	return token, false
+}
+
+func (p *expressionParser) expect(text string) (expressionToken, error) {
+	token, ok := p.accept(text)
+	if !ok {
+		return token, p.errorf(token.pos, "expected %q, got %q", text, token.text)
+	}
+	return token, nil
+}
+
+func (p *expressionParser) errorf(pos int, format string, args ...any) error {
+	return &ErrExpression{Expr: p.source, Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *expressionParser) parseOr() (expressionNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		token, ok := p.accept("||")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{operator: token.text, left: left, right: right, pos: token.pos}
+	}
+}
+
+func (p *expressionParser) parseAnd() (expressionNode, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		token, ok := p.accept("&&")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{operator: token.text, left: left, right: right, pos: token.pos}
+	}
+}
+
+func (p *expressionParser) parseComparison() (expressionNode, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	token, ok := p.accept("==", "!=", "<", "<=", ">", ">=", "in")
+	if !ok {
+		return left, nil
+	}
+
+	right, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	return &binaryNode{operator: token.text, left: left, right: right, pos: token.pos}, nil
+}
+
+func (p *expressionParser) parseAdditive() (expressionNode, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		token, ok := p.accept("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{operator: token.text, left: left, right: right, pos: token.pos}
+	}
+}
+
+func (p *expressionParser) parseMultiplicative() (expressionNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		token, ok := p.accept("*", "/", "%")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{operator: token.text, left: left, right: right, pos: token.pos}
+	}
+}
+
+func (p *expressionParser) parseUnary() (expressionNode, error) {
+	if token, ok := p.accept("!", "-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{operator: token.text, operand: operand, pos: token.pos}, nil
+	}
+
+	return p.parsePostfix()
+}
+
+func (p *expressionParser) parsePostfix() (expressionNode, error) {
+	node, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if token, ok := p.accept("."); ok {
+			name := p.next()
+			if name.kind != tokenIdent {
+				return nil, p.errorf(name.pos, "expected a field name, got %q", name.text)
+			}
+			node = &memberNode{target: node, name: name.text, pos: token.pos}
+			continue
+		}
+
+		if token, ok := p.accept("["); ok {
+			index, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if _, err = p.expect("]"); err != nil {
+				return nil, err
+			}
+			node = &indexNode{target: node, index: index, pos: token.pos}
+			continue
+		}
+
+		return node, nil
+	}
+}
+
+func (p *expressionParser) parsePrimary() (expressionNode, error) {
+	token := p.next()
+	switch token.kind {
+	case tokenNumber, tokenString:
+		return &literalNode{value: token.value, pos: token.pos}, nil
+	case tokenIdent:
+		switch token.text {
+		case "true":
+			return &literalNode{value: true, pos: token.pos}, nil
+		case "false":
+			return &literalNode{value: false, pos: token.pos}, nil
+		case "nil", "null":
+			return &literalNode{value: nil, pos: token.pos}, nil
+		}
+
+		if _, ok := p.accept("("); ok {
+			if _, known := expressionFunctions[token.text]; !known {
+				return nil, p.errorf(token.pos, "unknown function %q", token.text)
+			}
+			args, err := p.parseList(")")
+			if err != nil {
+				return nil, err
+			}
+			return &callNode{name: token.text, args: args, pos: token.pos}, nil
+		}
+
+		return &fieldNode{name: token.text, pos: token.pos}, nil
+	case tokenOperator:
+		switch token.text {
+		case "(":
+			node, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if _, err = p.expect(")"); err != nil {
+				return nil, err
+			}
+			return node, nil
+		case "[":
+			items, err := p.parseList("]")
+			if err != nil {
+				return nil, err
+			}
+			return &listNode{items: items, pos: token.pos}, nil
+		}
+	}
+
+	return nil, p.errorf(token.pos, "unexpected %q", token.text)
+}
+
+func (p *expressionParser) parseList(end string) (items []expressionNode, err error) {
+	if _, ok := p.accept(end); ok {
+		return nil, nil
+	}
+
+	for {
+		item, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+
+		if _, ok := p.accept(","); ok {
+			continue
+		}
+		if _, err = p.expect(end); err != nil {
+			return nil, err
+		}
+		return items, nil
+	}
+}
+
+// evaluation
+
+type expressionEnv struct {
+	source string
+	root   any
+}
+
+func (env *expressionEnv) errorf(pos int, format string, args ...any) error {
+	return &ErrExpression{Expr: env.source, Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+type expressionNode interface {
+	eval(env *expressionEnv) (any, error)
+	position() int
+}
+
+type literalNode struct {
+	value any
+	pos   int
+}
+
+func (n *literalNode) eval(*expressionEnv) (any, error) { return n.value, nil }
+func (n *literalNode) position() int                    { return n.pos }
+
+type listNode struct {
+	items []expressionNode
+	pos   int
+}
+
+func (n *listNode) position() int { return n.pos }
+func (n *listNode) eval(env *expressionEnv) (any, error) {
+	values := make([]any, 0, len(n.items))
+	for _, item := range n.items {
+		value, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+type fieldNode struct {
+	name string
+	pos  int
+}
+
+func (n *fieldNode) position() int { return n.pos }
+func (n *fieldNode) eval(env *expressionEnv) (any, error) {
+	value, ok := lookupField(env.root, n.name)
+	if !ok {
+		return nil, env.errorf(n.pos, "unknown field %q", n.name)
+	}
+	return value, nil
+}
+
+type memberNode struct {
+	target expressionNode
+	name   string
+	pos    int
+}
+
+func (n *memberNode) position() int { return n.pos }
+func (n *memberNode) eval(env *expressionEnv) (any, error) {
+	target, err := n.target.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := lookupField(target, n.name)
+	if !ok {
+		return nil, env.errorf(n.pos, "unknown field %q in %s", n.name, describeValue(target))
+	}
+	return value, nil
+}
+
+type indexNode struct {
+	target expressionNode
+	index  expressionNode
+	pos    int
+}
+
+func (n *indexNode) position() int { return n.pos }
+func (n *indexNode) eval(env *expressionEnv) (any, error) {
+	target, err := n.target.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	index, err := n.index.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	if key, ok := index.(string); ok {
+		value, found := lookupField(target, key)
+		if !found {
+			return nil, env.errorf(n.pos, "unknown key %q in %s", key, describeValue(target))
+		}
+		return value, nil
+	}
+
+	number, ok := index.(float64)
+	items, isList := normalizeList(target)
+	if !ok || !isList {
+		return nil, env.errorf(n.pos, "can not index %s with %s", describeValue(target), describeValue(index))
+	}
+	if number != math.Trunc(number) || number < 0 || int(number) >= len(items) {
+		return nil, env.errorf(n.pos, "index %v out of range", number)
+	}
+	return items[int(number)], nil
+}
+
+type callNode struct {
+	name string
+	args []expressionNode
+	pos  int
+}
+
+var expressionFunctions = map[string]func(args []any) (any, error){
+	"len": func(args []any) (any, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("len expects 1 argument")
+		}
+		if text, ok := args[0].(string); ok {
+			return float64(len([]rune(text))), nil
+		}
+		if items, ok := normalizeList(args[0]); ok {
+			return float64(len(items)), nil
+		}
+		if value := reflect.ValueOf(args[0]); value.Kind() == reflect.Map {
+			return float64(value.Len()), nil
+		}
+		return nil, fmt.Errorf("len of %s", describeValue(args[0]))
+	},
+	"lower": func(args []any) (any, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("lower expects 1 argument")
+		}
+		text, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("lower of %s", describeValue(args[0]))
+		}
+		return strings.ToLower(text), nil
+	},
+	"upper": func(args []any) (any, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("upper expects 1 argument")
+		}
+		text, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("upper of %s", describeValue(args[0]))
+		}
+		return strings.ToUpper(text), nil
+	},
+}
+
+func (n *callNode) position() int { return n.pos }
+func (n *callNode) eval(env *expressionEnv) (any, error) {
+	args := make([]any, 0, len(n.args))
+	for _, arg := range n.args {
+		value, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+
+	value, err := expressionFunctions[n.name](args)
+	if err != nil {
+		return nil, env.errorf(n.pos, "%v", err)
+	}
+	return value, nil
+}
+
+type unaryNode struct {
+	operator string
+	operand  expressionNode
+	pos      int
+}
+
+func (n *unaryNode) position() int { return n.pos }
+func (n *unaryNode) eval(env *expressionEnv) (any, error) {
+	value, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.operator {
+	case "!":
+		result, ok := value.(bool)
+		if !ok {
+			return nil, env.errorf(n.pos, "operator ! expects a boolean, got %s", describeValue(value))
+		}
+		return !result, nil
+	default:
+		number, ok := value.(float64)
+		if !ok {
+			return nil, env.errorf(n.pos, "operator - expects a number, got %s", describeValue(value))
+		}
+		return -number, nil
+	}
+}
+
+type logicalNode struct {
+	operator string
+	left     expressionNode
+	right    expressionNode
+	pos      int
+}
+
+func (n *logicalNode) position() int { return n.pos }
+func (n *logicalNode) eval(env *expressionEnv) (any, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	leftBool, ok := left.(bool)
+	if !ok {
+		return nil, env.errorf(n.left.position(), "operator %s expects a boolean, got %s", n.operator, describeValue(left))
+	}
+
+	// short circuit
+	if (n.operator == "&&" && !leftBool) || (n.operator == "||" && leftBool) {
+		return leftBool, nil
+	}
+
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	rightBool, ok := right.(bool)
+	if !ok {
+		return nil, env.errorf(n.right.position(), "operator %s expects a boolean, got %s", n.operator, describeValue(right))
+	}
+
+	return rightBool, nil
+}
+
+type binaryNode struct {
+	operator string
+	left     expressionNode
+	right    expressionNode
+	pos      int
+}
+
+func (n *binaryNode) position() int { return n.pos }
+func (n *binaryNode) eval(env *expressionEnv) (any, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.operator {
+	case "==":
+		return valuesEqual(left, right), nil
+	case "!=":
+		return !valuesEqual(left, right), nil
+	case "in":
+		items, ok := normalizeList(right)
+		if !ok {
+			if text, isText := right.(string); isText {
+				if sub, isSub := left.(string); isSub {
+					return strings.Contains(text, sub), nil
+				}
+			}
+			return nil, env.errorf(n.pos, "operator in expects a list, got %s", describeValue(right))
+		}
+		for _, item := range items {
+			if valuesEqual(left, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "<", "<=", ">", ">=":
+		comparison, ok := compareValues(left, right)
+		if !ok {
+			return nil, env.errorf(n.pos, "can not compare %s with %s", describeValue(left), describeValue(right))
+		}
+		switch n.operator {
+		case "<":
+			return comparison < 0, nil
+		case "<=":
+			return comparison <= 0, nil
+		case ">":
+			return comparison > 0, nil
+		default:
+			return comparison >= 0, nil
+		}
+	}
+
+	if n.operator == "+" {
+		if leftText, ok := left.(string); ok {
+			if rightText, ok := right.(string); ok {
+				return leftText + rightText, nil
+			}
+		}
+	}
+
+	leftNumber, leftOk := left.(float64)
+	rightNumber, rightOk := right.(float64)
+	if !leftOk || !rightOk {
+		return nil, env.errorf(n.pos, "operator %s expects numbers, got %s and %s", n.operator, describeValue(left), describeValue(right))
+	}
+
+	switch n.operator {
+	case "+":
+		return leftNumber + rightNumber, nil
+	case "-":
+		return leftNumber - rightNumber, nil
+	case "*":
+		return leftNumber * rightNumber, nil
+	case "/":
+		if rightNumber == 0 {
+			return nil, env.errorf(n.pos, "division by zero")
+		}
+		return leftNumber / rightNumber, nil
+	default:
+		if rightNumber == 0 {
+			return nil, env.errorf(n.pos, "division by zero")
+		}
+		return math.Mod(leftNumber, rightNumber), nil
+	}
+}
+
+// lookupField gets a field of a struct (by json tag or name, the fields of embedded structs included) or a key
+// of a map, the values are normalized so numbers are float64
+func lookupField(target any, name string) (any, bool) {
+	value := reflect.ValueOf(target)
+	for value.IsValid() && (value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface) {
+		if value.IsNil() {
+			return nil, false
+		}
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		item := value.MapIndex(reflect.ValueOf(name).Convert(value.Type().Key()))
+		if !item.IsValid() {
+			return nil, false
+		}
+		return normalizeValue(item), true
+	case reflect.Struct:
+		// an exact match of the json tag or the name first, then the name in any case
+		fields := reflect.VisibleFields(value.Type())
+		for _, match := range []func(field reflect.StructField, tag string) bool{
+			func(field reflect.StructField, tag string) bool { return tag == name || field.Name == name },
+			func(field reflect.StructField, tag string) bool { return strings.EqualFold(field.Name, name) },
+		} {
+			for _, field := range fields {
+				if !field.IsExported() || !match(field, strings.Split(field.Tag.Get("json"), ",")[0]) {
+					continue
+				}
+				item, err := value.FieldByIndexErr(field.Index)
+				if err != nil {
+					// a field promoted from a nil embedded pointer
+					return nil, true
+				}
+				return normalizeValue(item), true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// normalizeValue converts the numbers to float64 and dereferences pointers, a nil pointer or interface is nil
+func normalizeValue(value reflect.Value) any {
+	if !value.IsValid() {
+		return nil
+	}
+
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		return value.Float()
+	case reflect.Bool:
+		return value.Bool()
+	case reflect.String:
+		return value.String()
+	default:
+		return value.Interface()
+	}
+}
+
+// normalizeList converts slices and arrays to a list of normalized values
+func normalizeList(target any) ([]any, bool) {
+	if items, ok := target.([]any); ok {
+		return items, true
+	}
+
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		return nil, false
+	}
+
+	items := make([]any, 0, value.Len())
+	for i := 0; i < value.Len(); i++ {
+		items = append(items, normalizeValue(value.Index(i)))
+	}
+
+	return items, true
+}
+
+func valuesEqual(left, right any) bool {
+	left, right = normalizeValue(reflect.ValueOf(left)), normalizeValue(reflect.ValueOf(right))
+	if left == nil || right == nil {
+		return left == nil && right == nil
+	}
+
+	return reflect.DeepEqual(left, right)
+}
+
+func compareValues(left, right any) (int, bool) {
+	switch leftValue := left.(type) {
+	case float64:
+		rightValue, ok := right.(float64)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case leftValue < rightValue:
+			return -1, true
+		case leftValue > rightValue:
+			return 1, true
+		}
+		return 0, true
+	case string:
+		rightValue, ok := right.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(leftValue, rightValue), true
+	}
+
+	return 0, false
+}
+
+func describeValue(value any) string {
+	if value == nil {
+		return "nil"
+	}
+
+	switch value.(type) {
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "list"
+	}
+
+	return reflect.TypeOf(value).String()
+}
@@ -0,0 +1,267 @@
+package state_machine
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCompileExpressionErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantPos int
+		wantMsg string
+	}{
+		{expr: "", wantPos: 0, wantMsg: `unexpected "end of expression"`},
+		{expr: "total >", wantPos: 7, wantMsg: `unexpected "end of expression"`},
+		{expr: "total > > 1", wantPos: 8, wantMsg: `unexpected ">"`},
+		{expr: "total == 1 2", wantPos: 11, wantMsg: `unexpected "2"`},
+		{expr: "(total", wantPos: 6, wantMsg: `expected ")", got "end of expression"`},
+		{expr: "[1, 2", wantPos: 5, wantMsg: `expected "]", got "end of expression"`},
+		{expr: "customer.1", wantPos: 9, wantMsg: `expected a field name, got "1"`},
+		{expr: "total @ 1", wantPos: 6, wantMsg: "unexpected character '@'"},
+		{expr: "'abc", wantPos: 0, wantMsg: "unterminated string"},
+		{expr: "unknown(1)", wantPos: 0, wantMsg: `unknown function "unknown"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			_, err := CompileExpression(test.expr)
+			var exprErr *ErrExpression
+			if !errors.As(err, &exprErr) || exprErr.Pos != test.wantPos || exprErr.Msg != test.wantMsg {
+				t.Errorf("CompileExpression(%q) = %v, want %q at position %d", test.expr, err, test.wantMsg, test.wantPos)
+			}
+		})
+	}
+}
+
+func TestExpressionOperators(t *testing.T) {
+	obj := map[string]any{
+		"total":    10,
+		"discount": 2.5,
+		"country":  "PT",
+		"paid":     true,
+		"items":    []any{"book", "pen"},
+		"coupon":   nil,
+	}
+
+	tests := []struct {
+		expr string
+		want any
+	}{
+		{expr: "total + 5", want: 15.0},
+		{expr: "total - discount", want: 7.5},
+		{expr: "total * 2 + 1", want: 21.0},
+		{expr: "total * (2 + 1)", want: 30.0},
+		{expr: "total / 4", want: 2.5},
+		{expr: "total % 3", want: 1.0},
+		{expr: "-total", want: -10.0},
+		{expr: "total == 10", want: true},
+		{expr: "total != 10", want: false},
+		{expr: "total > 5 && total <= 10", want: true},
+		{expr: "total < 5 || total >= 10", want: true},
+		{expr: "!paid", want: false},
+		{expr: "country == 'PT'", want: true},
+		{expr: `country < "ES"`, want: false},
+		{expr: "country in ['PT', 'ES']", want: true},
+		{expr: "'pen' in items", want: true},
+		{expr: "items[0]", want: "book"},
+		{expr: "len(items)", want: 2.0},
+		{expr: "lower(country)", want: "pt"},
+		{expr: "upper('pt') == country", want: true},
+		{expr: "coupon == nil", want: true},
+		{expr: "paid || missing", want: true},
+		{expr: "!paid && missing", want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			expr, err := CompileExpression(test.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, err := expr.Eval(obj); err != nil || got != test.want {
+				t.Errorf("Eval(%q) = %v, %v, want %v", test.expr, got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestExpressionEvalErrors(t *testing.T) {
+	obj := map[string]any{"total": 10, "country": "PT", "items": []any{"book"}}
+
+	tests := []struct {
+		expr    string
+		wantPos int
+		wantMsg string
+	}{
+		{expr: "missing", wantPos: 0, wantMsg: `unknown field "missing"`},
+		{expr: "country > 1", wantPos: 8, wantMsg: "can not compare string with number"},
+		{expr: "total + 'a'", wantPos: 6, wantMsg: "operator + expects numbers, got number and string"},
+		{expr: "total / 0", wantPos: 6, wantMsg: "division by zero"},
+		{expr: "items[5]", wantPos: 5, wantMsg: "index 5 out of range"},
+		{expr: "!total", wantPos: 0, wantMsg: "operator ! expects a boolean, got number"},
+		{expr: "total && true", wantPos: 0, wantMsg: "operator && expects a boolean, got number"},
+		{expr: "total", wantPos: 0, wantMsg: "expected a boolean result, got number"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			expr, err := CompileExpression(test.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = expr.EvalBool(obj)
+			var exprErr *ErrExpression
+			if !errors.As(err, &exprErr) || exprErr.Pos != test.wantPos || exprErr.Msg != test.wantMsg {
+				t.Errorf("EvalBool(%q) = %v, want %q at position %d", test.expr, err, test.wantMsg, test.wantPos)
+			}
+		})
+	}
+}
+
+type expressionAudit struct {
+	CreatedBy string `json:"created_by"`
+}
+
+type expressionCustomer struct {
+	Country string
+}
+
+type expressionOrder struct {
+	expressionAudit
+	*expressionCustomer
+	Id       string
+	ID       int
+	Total    float64 `json:"amount"`
+	Lines    []expressionLine
+	Metadata map[string]string
+}
+
+type expressionLine struct {
+	Sku string `json:"sku"`
+}
+
+func TestExpressionFields(t *testing.T) {
+	order := &expressionOrder{
+		expressionAudit:    expressionAudit{CreatedBy: "alice"},
+		expressionCustomer: &expressionCustomer{Country: "PT"},
+		Id:                 "order-1",
+		ID:                 7,
+		Total:              20,
+		Lines:              []expressionLine{{Sku: "book"}},
+		Metadata:           map[string]string{"channel": "web"},
+	}
+
+	tests := []struct {
+		name    string
+		expr    string
+		obj     any
+		want    any
+		wantErr bool
+	}{
+		{name: "json tag", expr: "amount", obj: order, want: 20.0},
+		{name: "field name", expr: "Total", obj: order, want: 20.0},
+		{name: "field name in any case", expr: "total", obj: order, want: 20.0},
+		{name: "exact name before any case", expr: "ID", obj: order, want: 7.0},
+		{name: "other exact name", expr: "Id", obj: order, want: "order-1"},
+		{name: "embedded struct field", expr: "created_by", obj: order, want: "alice"},
+		{name: "embedded pointer field", expr: "country", obj: order, want: "PT"},
+		{name: "nil embedded pointer field", expr: "Country == nil", obj: &expressionOrder{}, want: true},
+		{name: "struct in a list", expr: "lines[0].sku", obj: order, want: "book"},
+		{name: "map key", expr: "metadata.channel", obj: order, want: "web"},
+		{name: "map index", expr: "metadata['channel']", obj: order, want: "web"},
+		{name: "struct value", expr: "amount > 10", obj: *order, want: true},
+		{name: "unknown field", expr: "customer", obj: order, wantErr: true},
+		{name: "unknown map key", expr: "metadata.origin", obj: order, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expr, err := CompileExpression(test.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := expr.Eval(test.obj)
+			if test.wantErr {
+				if !errors.Is(err, &ErrExpression{}) {
+					t.Errorf("Eval(%q) = %v, %v, want an ErrExpression", test.expr, got, err)
+				}
+				return
+			}
+			if err != nil || got != test.want {
+				t.Errorf("Eval(%q) = %v, %v, want %v", test.expr, got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestGuardInput(t *testing.T) {
+	obj := map[string]any{"role": "ADMIN", "blocked": false, "total": 10}
+
+	tests := []struct {
+		name      string
+		guard     string
+		wantInput GuardInput
+		want      bool
+	}{
+		{
+			name:      "string",
+			guard:     `"total > 0"`,
+			wantInput: GuardInput{Expr: "total > 0"},
+			want:      true,
+		},
+		{
+			name:      "object with an expression",
+			guard:     `{"expr":"total > 10"}`,
+			wantInput: GuardInput{Expr: "total > 10"},
+			want:      false,
+		},
+		{
+			name:  "groups of strings and objects",
+			guard: `{"any":["role == 'USER'",{"all":["total > 0",{"not":"blocked"}]}]}`,
+			wantInput: GuardInput{Any: []GuardInput{
+				{Expr: "role == 'USER'"},
+				{All: []GuardInput{{Expr: "total > 0"}, {Not: &GuardInput{Expr: "blocked"}}}},
+			}},
+			want: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var input GuardInput
+			if err := json.Unmarshal([]byte(test.guard), &input); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(input, test.wantInput) {
+				t.Fatalf("guard = %+v, want %+v", input, test.wantInput)
+			}
+
+			var reloaded GuardInput
+			data, err := json.Marshal(input)
+			if err == nil {
+				err = json.Unmarshal(data, &reloaded)
+			}
+			if err != nil || !reflect.DeepEqual(reloaded, input) {
+				t.Errorf("guard marshaled as %s = %+v, %v, want %+v", data, reloaded, err, input)
+			}
+
+			guard, err := CompileGuard(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := guard.Eval(obj); err != nil || got != test.want {
+				t.Errorf("Eval = %v, %v, want %v", got, err, test.want)
+			}
+		})
+	}
+
+	if _, err := CompileGuard(GuardInput{Expr: "total > 0", Not: &GuardInput{Expr: "blocked"}}); err == nil {
+		t.Error("CompileGuard of an expression and a group = nil, want an error")
+	}
+}
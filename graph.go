@@ -0,0 +1,242 @@
+package state_machine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DanglingTarget a transition whose target state is not declared
+type DanglingTarget struct {
+	// State where the transition is declared
+	State string `json:"state"`
+	// Transition target that is not declared as a state
+	Transition string `json:"transition"`
+}
+
+// GraphAnalysis structural analysis of a state machine definition
+type GraphAnalysis struct {
+	// Machine
+	Machine string `json:"machine"`
+	// Initial states used as roots of the reachability analysis
+	Initial []string `json:"initial"`
+	// States declared in the definition
+	States []string `json:"states"`
+	// UndeclaredInitial initial states that are not declared
+	UndeclaredInitial []string `json:"undeclared_initial,omitempty"`
+	// Unreachable declared states that can not be reached from the initial states
+	Unreachable []string `json:"unreachable,omitempty"`
+	// DanglingTargets transitions to states that are not declared
+	DanglingTargets []DanglingTarget `json:"dangling_targets,omitempty"`
+	// Terminal declared states without outgoing transitions
+	Terminal []string `json:"terminal,omitempty"`
+	// Cycles strongly connected components that contain at least one cycle
+	Cycles [][]string `json:"cycles,omitempty"`
+	// StronglyConnectedComponents every strongly connected component of the graph
+	StronglyConnectedComponents [][]string `json:"strongly_connected_components"`
+}
+
+// Err returns an error describing the structural problems of the definition, or nil when there are none.
+// Terminal states and cycles are not considered problems.
+func (a *GraphAnalysis) Err() error {
+	var problems []string
+	for _, state := range a.UndeclaredInitial {
+		problems = append(problems, fmt.Sprintf("initial state [%s] is not declared", state))
+	}
+
+	for _, state := range a.Unreachable {
+		problems = append(problems, fmt.Sprintf("state [%s] is unreachable", state))
+	}
+
+	for _, dangling := range a.DanglingTargets {
+		problems = append(problems, fmt.Sprintf("transition [%s] -> [%s] targets an undeclared state", dangling.State, dangling.Transition))
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("state machine [%s] has %d structural problem(s):\n - %s", a.Machine, len(problems), strings.Join(problems, "\n - "))
+}
+
+// Analyze analyses the graph of states and transitions.
+// When no initial states are given the declared initial states (of the main region and of the regions) are used, and
+// the reachability analysis is skipped when there is none.
+func (sm *StateMachine) Analyze(initialStates ...string) *GraphAnalysis {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+
+	if len(initialStates) == 0 && sm.initialState != "" {
+		initialStates = []string{sm.initialState}
+		for _, region := range sm.regions {
+			if initial := sm.regionInitials[region]; initial != "" {
+				initialStates = append(initialStates, initial)
+			}
+		}
+	}
+
+	analysis := &GraphAnalysis{
+		Machine: sm.Name,
+		Initial: initialStates,
+		States:  sortedKeys(sm.MapStates),
+	}
+
+	// nodes are the declared states plus every transition target
+	edges := make(map[string][]string)
+	for _, state := range analysis.States {
+		targets := sortedKeys(sm.MapStates[state])
+		edges[state] = sm.graphEdges(state)
+
+		if len(edges[state]) == 0 {
+			analysis.Terminal = append(analysis.Terminal, state)
+		}
+
+		for _, target := range targets {
+			if _, declared := sm.MapStates[target]; !declared {
+				analysis.DanglingTargets = append(analysis.DanglingTargets, DanglingTarget{
+					State:      state,
+					Transition: target,
+				})
+				if _, ok := edges[target]; !ok {
+					edges[target] = nil
+				}
+			}
+		}
+	}
+
+	if len(initialStates) > 0 {
+		reached := make(map[string]bool)
+		queue := make([]string, 0, len(initialStates))
+		for _, state := range initialStates {
+			if _, declared := sm.MapStates[state]; !declared {
+				analysis.UndeclaredInitial = append(analysis.UndeclaredInitial, state)
+				continue
+			}
+			if !reached[state] {
+				reached[state] = true
+				queue = append(queue, state)
+			}
+		}
+
+		for len(queue) > 0 {
+			state := queue[0]
+			queue = queue[1:]
+			for _, target := range edges[state] {
+				if !reached[target] {
+					reached[target] = true
+					queue = append(queue, target)
+				}
+			}
+		}
+
+		// a composite state is reached with any of its descendants
+		for _, state := range sortedKeys(reached) {
+			for _, ancestor := range sm.ancestors(state) {
+				reached[ancestor] = true
+			}
+		}
+
+		for _, state := range analysis.States {
+			if !reached[state] {
+				analysis.Unreachable = append(analysis.Unreachable, state)
+			}
+		}
+	}
+
+	analysis.StronglyConnectedComponents = stronglyConnectedComponents(edges)
+	for _, component := range analysis.StronglyConnectedComponents {
+		if len(component) > 1 || hasSelfLoop(edges, component[0]) {
+			analysis.Cycles = append(analysis.Cycles, component)
+		}
+	}
+
+	return analysis
+}
+
+// graphEdges returns the targets of the transitions of a state, including the inherited ones,
+// and the initial child of a composite state. The caller must hold the lock.
+func (sm *StateMachine) graphEdges(state string) []string {
+	targets := make(map[string]bool)
+	for _, ancestor := range sm.lineage(state) {
+		for target := range sm.MapStates[ancestor] {
+			targets[target] = true
+		}
+	}
+
+	if child := sm.initialChildren[state]; child != "" {
+		targets[child] = true
+	}
+
+	return sortedKeys(targets)
+}
+
+// stronglyConnectedComponents computes the components with the tarjan algorithm
+func stronglyConnectedComponents(edges map[string][]string) [][]string {
+	var (
+		index      int
+		stack      []string
+		components [][]string
+		indexes    = make(map[string]int)
+		lowLinks   = make(map[string]int)
+		onStack    = make(map[string]bool)
+	)
+
+	var connect func(node string)
+	connect = func(node string) {
+		indexes[node] = index
+		lowLinks[node] = index
+		index++
+		stack = append(stack, node)
+		onStack[node] = true
+
+		for _, target := range edges[node] {
+			if _, visited := indexes[target]; !visited {
+				connect(target)
+				if lowLinks[target] < lowLinks[node] {
+					lowLinks[node] = lowLinks[target]
+				}
+			} else if onStack[target] {
+				if indexes[target] < lowLinks[node] {
+					lowLinks[node] = indexes[target]
+				}
+			}
+		}
+
+		if lowLinks[node] == indexes[node] {
+			var component []string
+			for {
+				last := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[last] = false
+				component = append(component, last)
+				if last == node {
+					break
+				}
+			}
+			sort.Strings(component)
+			components = append(components, component)
+		}
+	}
+
+	for _, node := range sortedKeys(edges) {
+		if _, visited := indexes[node]; !visited {
+			connect(node)
+		}
+	}
+
+	sort.Slice(components, func(i, j int) bool {
+		return components[i][0] < components[j][0]
+	})
+
+	return components
+}
+
+func hasSelfLoop(edges map[string][]string, node string) bool {
+	for _, target := range edges[node] {
+		if target == node {
+			return true
+		}
+	}
+
+	return false
+}
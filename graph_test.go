@@ -0,0 +1,118 @@
+package state_machine
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// definitionFile writes a json definition to a file, like the definitions of the applications
+func definitionFile(t *testing.T, definition string) string {
+	t.Helper()
+
+	filePath := filepath.Join(t.TempDir(), "definition.json")
+	if err := os.WriteFile(filePath, []byte(definition), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return filePath
+}
+
+// loadDefinition loads a json definition from a file
+func loadDefinition(t *testing.T, sm IStateMachine, definition string) {
+	t.Helper()
+
+	if err := sm.Load(definitionFile(t, definition)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		name              string
+		definition        string
+		initial           []string
+		wantUnreachable   []string
+		wantTerminal      []string
+		wantDangling      []DanglingTarget
+		wantUndeclared    []string
+		wantCycles        [][]string
+		wantComponentsLen int
+		wantErr           bool
+	}{
+		{
+			name: "linear machine",
+			definition: `{"name":"orders","states":[
+				{"name":"pending","transitions":[{"name":"paid"}]},
+				{"name":"paid","transitions":[{"name":"shipped"}]},
+				{"name":"shipped"}]}`,
+			initial:           []string{"pending"},
+			wantTerminal:      []string{"shipped"},
+			wantComponentsLen: 3,
+		},
+		{
+			name: "unreachable and dead end states",
+			definition: `{"name":"orders","states":[
+				{"name":"pending","transitions":[{"name":"paid"}]},
+				{"name":"paid"},
+				{"name":"archived","transitions":[{"name":"pending"}]}]}`,
+			initial:           []string{"pending"},
+			wantUnreachable:   []string{"archived"},
+			wantTerminal:      []string{"paid"},
+			wantComponentsLen: 3,
+			wantErr:           true,
+		},
+		{
+			name: "cycles of strongly connected components",
+			definition: `{"name":"orders","states":[
+				{"name":"pending","transitions":[{"name":"paid"}]},
+				{"name":"paid","transitions":[{"name":"refunded"},{"name":"shipped"}]},
+				{"name":"refunded","transitions":[{"name":"pending"}]},
+				{"name":"shipped","transitions":[{"name":"shipped"}]}]}`,
+			initial:           []string{"pending"},
+			wantCycles:        [][]string{{"paid", "pending", "refunded"}, {"shipped"}},
+			wantComponentsLen: 2,
+		},
+		{
+			name: "dangling targets and undeclared initial states",
+			definition: `{"name":"orders","states":[
+				{"name":"pending","transitions":[{"name":"lost"}]}]}`,
+			initial:           []string{"pending", "draft"},
+			wantDangling:      []DanglingTarget{{State: "pending", Transition: "lost"}},
+			wantUndeclared:    []string{"draft"},
+			wantComponentsLen: 2,
+			wantErr:           true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sm := NewStateMachine()
+			loadDefinition(t, sm, test.definition)
+
+			analysis := sm.Analyze(test.initial...)
+			if !reflect.DeepEqual(analysis.Unreachable, test.wantUnreachable) {
+				t.Errorf("Unreachable = %v, want %v", analysis.Unreachable, test.wantUnreachable)
+			}
+			if !reflect.DeepEqual(analysis.Terminal, test.wantTerminal) {
+				t.Errorf("Terminal = %v, want %v", analysis.Terminal, test.wantTerminal)
+			}
+			if !reflect.DeepEqual(analysis.DanglingTargets, test.wantDangling) {
+				t.Errorf("DanglingTargets = %v, want %v", analysis.DanglingTargets, test.wantDangling)
+			}
+			if !reflect.DeepEqual(analysis.UndeclaredInitial, test.wantUndeclared) {
+				t.Errorf("UndeclaredInitial = %v, want %v", analysis.UndeclaredInitial, test.wantUndeclared)
+			}
+			if !reflect.DeepEqual(analysis.Cycles, test.wantCycles) {
+				t.Errorf("Cycles = %v, want %v", analysis.Cycles, test.wantCycles)
+			}
+			if len(analysis.StronglyConnectedComponents) != test.wantComponentsLen {
+				t.Errorf("StronglyConnectedComponents = %v, want %d components", analysis.StronglyConnectedComponents, test.wantComponentsLen)
+			}
+			if err := analysis.Err(); (err != nil) != test.wantErr {
+				t.Errorf("Err() = %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package state_machine
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// GuardInput the guard of a transition, an expression or an all/any/not group of guards.
+// In the definition an expression can be given directly as a string:
+//
+//	"guard": "total > 0 && country == 'BE'"
+//	"guard": {"any": ["role == 'ADMIN'", {"not": "blocked"}]}
+type GuardInput struct {
+	// Expr
+	Expr string `json:"expr,omitempty"`
+	// All guards must pass
+	All []GuardInput `json:"all,omitempty"`
+	// Any guard must pass
+	Any []GuardInput `json:"any,omitempty"`
+	// Not inverts the guard
+	Not *GuardInput `json:"not,omitempty"`
+}
+
+// MarshalJSON writes the guards with only an expression as a string
+func (g GuardInput) MarshalJSON() ([]byte, error) {
+	if g.Expr != "" && len(g.All) == 0 && len(g.Any) == 0 && g.Not == nil {
+		return json.Marshal(g.Expr)
+	}
+
+	type guardInput GuardInput
+	return json.Marshal(guardInput(g))
+}
+
+// UnmarshalJSON reads a guard given as a string or as an object
+func (g *GuardInput) UnmarshalJSON(data []byte) error {
+	var expr string
+	if err := json.Unmarshal(data, &expr); err == nil {
+		*g = GuardInput{Expr: expr}
+		return nil
+	}
+
+	type guardInput GuardInput
+	return json.Unmarshal(data, (*guardInput)(g))
+}
+
+// guardInputDecodeHook decodes the guards given as a string when loading a definition
+func guardInputDecodeHook(from reflect.Type, to reflect.Type, data any) (any, error) {
+	if from.Kind() == reflect.String && to == reflect.TypeOf(GuardInput{}) {
+		return GuardInput{Expr: data.(string)}, nil
+	}
+
+	return data, nil
+}
+
+// Guard a compiled guard
+type Guard struct {
+	expr *Expression
+	all  []*Guard
+	any  []*Guard
+	not  *Guard
+}
+
+// CompileGuard compiles the expressions of a guard
+func CompileGuard(input GuardInput) (*Guard, error) {
+	groups := 0
+	for _, set := range []bool{input.Expr != "", len(input.All) > 0, len(input.Any) > 0, input.Not != nil} {
+		if set {
+			groups++
+		}
+	}
+	if groups != 1 {
+		return nil, fmt.Errorf("a guard must have exactly one of expr, all, any or not")
+	}
+
+	guard := &Guard{}
+	switch {
+	case input.Expr != "":
+		expr, err := CompileExpression(input.Expr)
+		if err != nil {
+			return nil, err
+		}
+		guard.expr = expr
+	case input.Not != nil:
+		not, err := CompileGuard(*input.Not)
+		if err != nil {
+			return nil, err
+		}
+		guard.not = not
+	default:
+		for _, item := range input.All {
+			compiled, err := CompileGuard(item)
+			if err != nil {
+				return nil, err
+			}
+			guard.all = append(guard.all, compiled)
+		}
+		for _, item := range input.Any {
+			compiled, err := CompileGuard(item)
+			if err != nil {
+				return nil, err
+			}
+			guard.any = append(guard.any, compiled)
+		}
+	}
+
+	return guard, nil
+}
+
+// Input returns the definition of the guard
+func (g *Guard) Input() GuardInput {
+	switch {
+	case g.expr != nil:
+		return GuardInput{Expr: g.expr.String()}
+	case g.not != nil:
+		not := g.not.Input()
+		return GuardInput{Not: &not}
+	}
+
+	var input GuardInput
+	for _, item := range g.all {
+		input.All = append(input.All, item.Input())
+	}
+	for _, item := range g.any {
+		input.Any = append(input.Any, item.Input())
+	}
+
+	return input
+}
+
+// MarshalJSON writes the definition of the guard
+func (g *Guard) MarshalJSON() ([]byte, error) {
+	return json.Marshal(g.Input())
+}
+
+// String returns the guard, e.g. all(total > 0, not(blocked))
+func (g *Guard) String() string {
+	switch {
+	case g.expr != nil:
+		return g.expr.String()
+	case g.not != nil:
+		return "not(" + g.not.String() + ")"
+	}
+
+	name, items := "all", g.all
+	if len(g.any) > 0 {
+		name, items = "any", g.any
+	}
+
+	parts := make([]string, 0, len(items))
+	for _, item := range items {
+		parts = append(parts, item.String())
+	}
+
+	return name + "(" + strings.Join(parts, ", ") + ")"
+}
+
+// Eval evaluates the guard against the object, the groups are evaluated with short circuit
+func (g *Guard) Eval(obj any) (bool, error) {
+	switch {
+	case g.expr != nil:
+		return g.expr.EvalBool(obj)
+	case g.not != nil:
+		success, err := g.not.Eval(obj)
+		return !success, err
+	case len(g.any) > 0:
+		for _, item := range g.any {
+			success, err := item.Eval(obj)
+			if err != nil || success {
+				return success, err
+			}
+		}
+		return false, nil
+	}
+
+	for _, item := range g.all {
+		success, err := item.Eval(obj)
+		if err != nil || !success {
+			return success, err
+		}
+	}
+
+	return true, nil
+}
+
+// buildGuard compiles the guard of a transition, if any
+func buildGuard(input *GuardInput) (*Guard, error) {
+	if input == nil {
+		return nil, nil
+	}
+
+	return CompileGuard(*input)
+}
@@ -0,0 +1,66 @@
+package state_machine
+
+import (
+	"testing"
+)
+
+func TestGuardEvalNil(t *testing.T) {
+	obj := map[string]any{"coupon": nil, "total": 10, "customer": map[string]any{"country": "PT"}}
+
+	tests := []struct {
+		name string
+		expr string
+		want bool
+	}{
+		{name: "nil field equals nil", expr: "coupon == nil", want: true},
+		{name: "value equals nil", expr: "total == nil", want: false},
+		{name: "value not equals nil", expr: "total != nil", want: true},
+		{name: "nil field not equals nil", expr: "coupon != nil", want: false},
+		{name: "nil literals", expr: "nil == nil", want: true},
+		{name: "nil in list", expr: "coupon in [nil, 1]", want: true},
+		{name: "value in list with nil", expr: "total in [nil, 10]", want: true},
+		{name: "value not in list with nil", expr: "customer.country in [nil, 'ES']", want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			guard, err := CompileGuard(GuardInput{Expr: test.expr})
+			if err != nil {
+				t.Fatalf("compile %q: %v", test.expr, err)
+			}
+
+			got, err := guard.Eval(obj)
+			if err != nil {
+				t.Fatalf("eval %q: %v", test.expr, err)
+			}
+			if got != test.want {
+				t.Errorf("eval %q = %v, want %v", test.expr, got, test.want)
+			}
+		})
+	}
+}
+
+func TestProcessTransitionGuardNil(t *testing.T) {
+	definition := `{"name":"orders","states":[
+		{"name":"pending","initial":true,"transitions":[{"name":"paid","guard":"coupon == nil"}]},
+		{"name":"paid","final":true}]}`
+
+	state := "pending"
+	sm := NewStateMachine()
+	if err := sm.LoadFromBytes([]byte(definition), "json"); err != nil {
+		t.Fatal(err)
+	}
+	sm.AddCurrentStateFunction(func(any) (string, error) { return state, nil })
+	sm.AddExecuteFunction(func(nextState string, _ any) error {
+		state = nextState
+		return nil
+	})
+
+	success, err := sm.ProcessTransition("paid", map[string]any{"coupon": nil})
+	if err != nil || !success {
+		t.Fatalf("ProcessTransition = %v, %v, want true, nil", success, err)
+	}
+	if state != "paid" {
+		t.Errorf("state = %s, want paid", state)
+	}
+}
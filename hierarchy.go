@@ -0,0 +1,111 @@
+package state_machine
+
+import (
+	"fmt"
+)
+
+// Ancestors returns the parents of a state, from the nearest one to the root
+func (sm *StateMachine) Ancestors(state string) []string {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	return sm.ancestors(state)
+}
+
+// IsIn checks if the state is the ancestor state or one of its descendants,
+// e.g. a leaf state reported by the current state function is in every one of its parents
+func (sm *StateMachine) IsIn(state, ancestor string) bool {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+
+	if state == ancestor {
+		return true
+	}
+
+	for _, parent := range sm.ancestors(state) {
+		if parent == ancestor {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ancestors returns the parents of a state from the nearest one, the caller must hold the lock
+func (sm *StateMachine) ancestors(state string) (ancestors []string) {
+	seen := map[string]bool{state: true}
+	for parent := sm.parents[state]; parent != "" && !seen[parent]; parent = sm.parents[parent] {
+		seen[parent] = true
+		ancestors = append(ancestors, parent)
+	}
+
+	return ancestors
+}
+
+// leaf resolves a composite state to its initial child, down to a state without children,
+// the caller must hold the lock
+func (sm *StateMachine) leaf(state string) string {
+	seen := map[string]bool{state: true}
+	for child := sm.initialChildren[state]; child != "" && !seen[child]; child = sm.initialChildren[child] {
+		seen[child] = true
+		state = child
+	}
+
+	return state
+}
+
+// resolveState resolves a target state to the leaf state entered by the transition
+func (sm *StateMachine) resolveState(state string) string {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	return sm.leaf(state)
+}
+
+// lineage returns the state followed by its ancestors, the caller must hold the lock
+func (sm *StateMachine) lineage(state string) []string {
+	return append([]string{state}, sm.ancestors(state)...)
+}
+
+// exitedStates returns the states left by a transition, from the current state up to the common ancestor
+// (excluded) of the current and the next state. The entered states are the exited states of the reverse
+// transition, in reverse order. The caller must hold the lock.
+func (sm *StateMachine) exitedStates(currentState, nextState string) (states []string) {
+	if currentState == "" {
+		return nil
+	}
+
+	common := make(map[string]bool)
+	for _, ancestor := range sm.ancestors(nextState) {
+		common[ancestor] = true
+	}
+
+	for _, state := range sm.lineage(currentState) {
+		if common[state] {
+			break
+		}
+		states = append(states, state)
+	}
+
+	return states
+}
+
+// applyHierarchy checks the parents and the initial children of the states, the caller must hold the lock
+func (sm *StateMachine) applyHierarchy() error {
+	for _, state := range sortedKeys(sm.parents) {
+		seen := map[string]bool{state: true}
+		for parent := sm.parents[state]; parent != ""; parent = sm.parents[parent] {
+			if seen[parent] {
+				return fmt.Errorf("state [%s] of state machine [%s] is its own ancestor", parent, sm.Name)
+			}
+			seen[parent] = true
+		}
+	}
+
+	for _, state := range sortedKeys(sm.initialChildren) {
+		child := sm.initialChildren[state]
+		if sm.parents[child] != state {
+			return fmt.Errorf("initial child [%s] of state [%s] of state machine [%s] is not one of its children", child, state, sm.Name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package state_machine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const hierarchyDefinition = `{"name":"orders","states":[
+	{"name":"active","initial":true,"initial_child":"ordering",
+		"on_enter":[{"func":"enter(active)"}],"on_exit":[{"func":"exit(active)"}],
+		"transitions":[{"name":"canceled","event":"cancel"}]},
+	{"name":"ordering","parent":"active",
+		"on_enter":[{"func":"enter(ordering)"}],"on_exit":[{"func":"exit(ordering)"}],
+		"transitions":[{"name":"fulfilment"}]},
+	{"name":"fulfilment","parent":"active","initial_child":"packing",
+		"on_enter":[{"func":"enter(fulfilment)"}],"on_exit":[{"func":"exit(fulfilment)"}]},
+	{"name":"packing","parent":"fulfilment",
+		"on_enter":[{"func":"enter(packing)"}],"on_exit":[{"func":"exit(packing)"}],
+		"transitions":[{"name":"shipping"}]},
+	{"name":"shipping","parent":"fulfilment",
+		"on_enter":[{"func":"enter(shipping)"}],"on_exit":[{"func":"exit(shipping)"}]},
+	{"name":"canceled","final":true,"on_enter":[{"func":"enter(canceled)"}]}]}`
+
+func TestHierarchyTransitions(t *testing.T) {
+	tests := []struct {
+		name      string
+		state     string
+		nextState string
+		wantCalls []string
+	}{
+		{
+			name:      "transition inherited from the root",
+			state:     "packing",
+			nextState: "canceled",
+			wantCalls: []string{"exit packing", "exit fulfilment", "exit active", "execute canceled", "enter canceled"},
+		},
+		{
+			name:      "transition to a composite state enters its initial child",
+			state:     "ordering",
+			nextState: "fulfilment",
+			wantCalls: []string{"exit ordering", "execute packing", "enter fulfilment", "enter packing"},
+		},
+		{
+			name:      "transition between siblings keeps their parents",
+			state:     "packing",
+			nextState: "shipping",
+			wantCalls: []string{"exit packing", "execute shipping", "enter shipping"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sm := NewStateMachine(WithValidation())
+			if err := sm.LoadFromBytes([]byte(hierarchyDefinition), "json"); err != nil {
+				t.Fatal(err)
+			}
+
+			var calls []string
+			sm.AddCurrentStateFunction(func(any) (string, error) { return test.state, nil })
+			sm.AddExecuteFunction(func(nextState string, _ any) error {
+				calls = append(calls, "execute "+nextState)
+				return nil
+			})
+			for _, kind := range []string{"enter", "exit"} {
+				kind := kind
+				sm.AddOnSuccessFunction(kind, func(_ any, args ...string) (bool, error) {
+					calls = append(calls, kind+" "+args[0])
+					return true, nil
+				})
+			}
+
+			if success, err := sm.ProcessTransition(test.nextState, struct{}{}); !success || err != nil {
+				t.Fatalf("ProcessTransition = %v, %v, want a success", success, err)
+			}
+			if !reflect.DeepEqual(calls, test.wantCalls) {
+				t.Errorf("calls = %v, want %v", calls, test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestHierarchy(t *testing.T) {
+	sm := NewStateMachine()
+	if err := sm.LoadFromBytes([]byte(hierarchyDefinition), "json"); err != nil {
+		t.Fatal(err)
+	}
+
+	if ancestors := sm.Ancestors("packing"); !reflect.DeepEqual(ancestors, []string{"fulfilment", "active"}) {
+		t.Errorf("Ancestors(packing) = %v, want [fulfilment active]", ancestors)
+	}
+	if ancestors := sm.Ancestors("active"); len(ancestors) != 0 {
+		t.Errorf("Ancestors(active) = %v, want none", ancestors)
+	}
+
+	tests := []struct {
+		state, ancestor string
+		want            bool
+	}{
+		{state: "packing", ancestor: "packing", want: true},
+		{state: "packing", ancestor: "fulfilment", want: true},
+		{state: "packing", ancestor: "active", want: true},
+		{state: "packing", ancestor: "ordering", want: false},
+		{state: "active", ancestor: "packing", want: false},
+		{state: "canceled", ancestor: "active", want: false},
+	}
+	for _, test := range tests {
+		if got := sm.IsIn(test.state, test.ancestor); got != test.want {
+			t.Errorf("IsIn(%s, %s) = %v, want %v", test.state, test.ancestor, got, test.want)
+		}
+	}
+
+	if transitions := sm.getTransitions("packing"); !reflect.DeepEqual(transitions, []string{"shipping", "canceled"}) {
+		t.Errorf("transitions of packing = %v, want [shipping canceled]", transitions)
+	}
+}
+
+func TestHierarchyLoadErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		definition string
+		wantErr    string
+	}{
+		{
+			name: "cycle",
+			definition: `{"name":"orders","states":[
+				{"name":"a","initial":true,"parent":"b"},
+				{"name":"b","parent":"a"}]}`,
+			wantErr: "is its own ancestor",
+		},
+		{
+			name: "initial child of another state",
+			definition: `{"name":"orders","states":[
+				{"name":"a","initial":true,"initial_child":"c"},
+				{"name":"b"},
+				{"name":"c","parent":"b"}]}`,
+			wantErr: "initial child [c] of state [a] of state machine [orders] is not one of its children",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := NewStateMachine().LoadFromBytes([]byte(test.definition), "json")
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("LoadFromBytes = %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
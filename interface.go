@@ -1,5 +1,14 @@
 package state_machine
 
+import (
+	"context"
+	"io"
+	"io/fs"
+)
+
+// IStateMachine the core of a state machine: the definition, the handlers and the processing of transitions.
+// The other capabilities of a *StateMachine are behind the smaller interfaces below, so an implementation or a mock
+// of IStateMachine does not have to implement them. The Add* methods of a frozen state machine panic, see IFreezer.
 type IStateMachine interface {
 	GetName() string
 	Load(filePath string) error
@@ -13,3 +22,136 @@ type IStateMachine interface {
 	AddAdapterFunction(name string, handler HandlerAdapterFunction)
 	AddFilterFunction(name string, handler HandlerFilterFunction)
 }
+
+// IContextHandlers processes the transitions with a context and registers the handlers receiving it.
+// A triggered state machine implementing ProcessTransitionContext receives the context of the triggering transition.
+type IContextHandlers interface {
+	ProcessTransitionContext(ctx context.Context, nextState string, obj any) (success bool, err error)
+	AddCheckFunctionContext(name string, handler HandlerFuncContext)
+	AddOnErrorFunctionContext(name string, handler HandlerFuncContext)
+	AddOnSuccessFunctionContext(name string, handler HandlerFuncContext)
+	AddExecuteFunctionContext(handler HandlerExecFunctionContext)
+	AddCurrentStateFunctionContext(handler CurrentStateFuncContext)
+	AddAdapterFunctionContext(name string, handler HandlerAdapterFunctionContext)
+	AddFilterFunctionContext(name string, handler HandlerFilterFunctionContext)
+}
+
+// IDefinition loads, describes and serializes the definition, and processes the transition to its initial state
+type IDefinition interface {
+	GetInitialState() string
+	GetFinalStates() []string
+	IsFinalState(state string) bool
+	LoadFromFS(fsys fs.FS, filePath string) error
+	LoadFromBytes(data []byte, format string) error
+	LoadFromReader(reader io.Reader, format string) error
+	GetDefinition() Definition
+	MarshalDefinition(format string) ([]byte, error)
+	ProcessInitialTransition(obj any) (success bool, err error)
+	ProcessInitialTransitionContext(ctx context.Context, obj any) (success bool, err error)
+}
+
+// IValidator validates the handler references and analyses the graph of the definition
+type IValidator interface {
+	Validate() error
+	Analyze(initialStates ...string) *GraphAnalysis
+}
+
+// IFreezer stops the registrations and the loads of a state machine in use. Once frozen, the Add* methods
+// panic with an ErrFrozen, the loads return it, and the changes of the exported handler maps are ignored.
+type IFreezer interface {
+	Freeze()
+	IsFrozen() bool
+}
+
+// IExporter exports the graph of a state machine
+type IExporter interface {
+	ToDOT() string
+	ToMermaid() string
+}
+
+// IEvaluator evaluates the transitions without processing them
+type IEvaluator interface {
+	CanTransition(nextState string, obj any) (TransitionEvaluation, error)
+	CanTransitionContext(ctx context.Context, nextState string, obj any) (TransitionEvaluation, error)
+	AvailableTransitions(obj any) ([]TransitionEvaluation, error)
+	AvailableTransitionsContext(ctx context.Context, obj any) ([]TransitionEvaluation, error)
+}
+
+// IEvents processes the transitions by event
+type IEvents interface {
+	Fire(event string, obj any) (success bool, err error)
+	FireContext(ctx context.Context, event string, obj any) (success bool, err error)
+	CanFire(event string, obj any) (TransitionEvaluation, error)
+	CanFireContext(ctx context.Context, event string, obj any) (TransitionEvaluation, error)
+	Events(state string) []string
+}
+
+// IHierarchy describes the nested states
+type IHierarchy interface {
+	Ancestors(state string) []string
+	IsIn(state, ancestor string) bool
+}
+
+// IRegions describes the orthogonal regions and registers the handlers of their state vector
+type IRegions interface {
+	Regions() []string
+	RegionOf(state string) string
+	AddStateVectorFunction(handler StateVectorFunc)
+	AddStateVectorFunctionContext(handler StateVectorFuncContext)
+	AddExecuteVectorFunction(handler HandlerExecVectorFunction)
+	AddExecuteVectorFunctionContext(handler HandlerExecVectorFunctionContext)
+}
+
+// IStore persists the states, with a version against concurrent modifications, and the transactions of the transitions
+type IStore interface {
+	AddStateStore(store StateStore, objectId func(obj any) string)
+	AddTxManager(manager TxManager)
+	AddConflictRetry(retries int)
+	AddVersionedExecuteFunction(handler HandlerVersionedExecFunction)
+	AddVersionedCurrentStateFunction(handler VersionedCurrentStateFunc)
+	AddVersionedExecuteFunctionContext(handler HandlerVersionedExecFunctionContext)
+	AddVersionedCurrentStateFunctionContext(handler VersionedCurrentStateFuncContext)
+}
+
+// ICompensation registers the compensations of the transitions
+type ICompensation interface {
+	AddCompensateFunction(name string, handler HandlerFunc)
+	AddCompensateFunctionContext(name string, handler HandlerFuncContext)
+}
+
+// IAudit records the transition attempts
+type IAudit interface {
+	AddAuditSink(sink AuditSink)
+}
+
+// ITimers processes the scheduled transitions
+type ITimers interface {
+	ProcessDueTimers(ctx context.Context, load ObjectLoader) (processed int, err error)
+	AddTimerStore(store TimerStore, objectId func(obj any) string)
+	AddClock(clock Clock)
+}
+
+// IRetry retries the failing handlers
+type IRetry interface {
+	AddRetryPolicy(policy RetryPolicy)
+	AddRetryClassifier(classifier RetryClassifier)
+}
+
+var (
+	_ IStateMachine    = (*StateMachine)(nil)
+	_ AnyStateMachine  = (*StateMachine)(nil)
+	_ IContextHandlers = (*StateMachine)(nil)
+	_ IDefinition      = (*StateMachine)(nil)
+	_ IValidator       = (*StateMachine)(nil)
+	_ IFreezer         = (*StateMachine)(nil)
+	_ IExporter        = (*StateMachine)(nil)
+	_ IEvaluator       = (*StateMachine)(nil)
+	_ IEvents          = (*StateMachine)(nil)
+	_ IHierarchy       = (*StateMachine)(nil)
+	_ IRegions         = (*StateMachine)(nil)
+	_ IStore           = (*StateMachine)(nil)
+	_ ICompensation    = (*StateMachine)(nil)
+	_ IAudit           = (*StateMachine)(nil)
+	_ ITimers          = (*StateMachine)(nil)
+	_ IRetry           = (*StateMachine)(nil)
+)
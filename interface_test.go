@@ -0,0 +1,143 @@
+package state_machine
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// coreStateMachine implements only the core IStateMachine, like a mock of a triggered state machine
+type coreStateMachine struct {
+	transitions []string
+}
+
+func (m *coreStateMachine) GetName() string            { return "invoices" }
+func (m *coreStateMachine) Load(filePath string) error { return nil }
+func (m *coreStateMachine) ProcessTransition(nextState string, obj any) (bool, error) {
+	m.transitions = append(m.transitions, nextState)
+	return true, nil
+}
+func (m *coreStateMachine) AddCheckFunction(name string, handler HandlerFunc)     {}
+func (m *coreStateMachine) AddOnErrorFunction(name string, handler HandlerFunc)   {}
+func (m *coreStateMachine) AddOnSuccessFunction(name string, handler HandlerFunc) {}
+func (m *coreStateMachine) AddExecuteFunction(handler HandlerExecFunction)        {}
+func (m *coreStateMachine) AddCurrentStateFunction(handler CurrentStateFunc)      {}
+func (m *coreStateMachine) AddStateMachineToTrigger(name string, stateMachine IStateMachine) IStateMachine {
+	return m
+}
+func (m *coreStateMachine) AddAdapterFunction(name string, handler HandlerAdapterFunction) {}
+func (m *coreStateMachine) AddFilterFunction(name string, handler HandlerFilterFunction)   {}
+
+func TestTriggerCoreStateMachine(t *testing.T) {
+	invoices := &coreStateMachine{}
+	orders := NewStateMachine(WithValidation())
+	orders.AddStateMachineToTrigger("invoices", invoices)
+	if err := orders.LoadFromBytes([]byte(`{"name":"orders","states":[
+		{"name":"pending","initial":true,"transitions":[{"name":"paid","on_success":[{"func":"invoices","func_arg":["invoices","sent"],"is_state_machine":true}]}]},
+		{"name":"paid","final":true}]}`), "json"); err != nil {
+		t.Fatal(err)
+	}
+	orders.AddCurrentStateFunction(func(any) (string, error) { return "pending", nil })
+	orders.AddExecuteFunction(func(string, any) error { return nil })
+
+	if success, err := orders.ProcessTransition("paid", struct{}{}); err != nil || !success {
+		t.Fatalf("ProcessTransition = %v, %v, want true, nil", success, err)
+	}
+	if len(invoices.transitions) != 1 || invoices.transitions[0] != "sent" {
+		t.Errorf("triggered transitions = %v, want [sent]", invoices.transitions)
+	}
+}
+
+type contextKey struct{}
+
+func TestProcessTransitionContext(t *testing.T) {
+	tests := []struct {
+		name string
+		// cancel cancels the context before the transition
+		cancel func(cancel context.CancelFunc)
+		// cancelCheck cancels the context in the check of the transition
+		cancelCheck bool
+		wantSuccess bool
+		wantErr     error
+		wantCalls   []string
+	}{
+		{
+			name:        "the context reaches the triggered state machine",
+			wantSuccess: true,
+			wantCalls:   []string{"orders check", "execute paid", "invoices check", "execute sent"},
+		},
+		{
+			name:    "canceled before the transition",
+			cancel:  func(cancel context.CancelFunc) { cancel() },
+			wantErr: &ErrTransitionCanceled{},
+		},
+		{
+			name:        "canceled during the transition",
+			cancelCheck: true,
+			wantErr:     &ErrTransitionCanceled{},
+			wantCalls:   []string{"orders check"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.WithValue(context.Background(), contextKey{}, "request-1"))
+			defer cancel()
+
+			var calls []string
+			check := func(name string) HandlerFuncContext {
+				return func(ctx context.Context, _ any, _ ...string) (bool, error) {
+					if ctx.Value(contextKey{}) != "request-1" {
+						return false, errors.New(name + " check without the context of the transition")
+					}
+					calls = append(calls, name+" check")
+					if test.cancelCheck {
+						cancel()
+					}
+					return true, nil
+				}
+			}
+			execute := func(_ context.Context, nextState string, _ any) error {
+				calls = append(calls, "execute "+nextState)
+				return nil
+			}
+
+			invoices := NewStateMachine()
+			if err := invoices.LoadFromBytes([]byte(`{"name":"invoices","states":[
+				{"name":"draft","initial":true,"transitions":[{"name":"sent","check":[{"func":"canSend"}]}]},
+				{"name":"sent","final":true}]}`), "json"); err != nil {
+				t.Fatal(err)
+			}
+			invoices.AddCurrentStateFunction(func(any) (string, error) { return "draft", nil })
+			invoices.AddExecuteFunctionContext(execute)
+			invoices.AddCheckFunctionContext("canSend", check("invoices"))
+
+			orders := NewStateMachine()
+			orders.AddStateMachineToTrigger("invoices", invoices)
+			if err := orders.LoadFromBytes([]byte(`{"name":"orders","states":[
+				{"name":"pending","initial":true,"transitions":[{"name":"paid","check":[{"func":"isPaid"}],"on_success":[{"func":"invoices","func_arg":["invoices","sent"],"is_state_machine":true}]}]},
+				{"name":"paid","final":true}]}`), "json"); err != nil {
+				t.Fatal(err)
+			}
+			orders.AddCurrentStateFunction(func(any) (string, error) { return "pending", nil })
+			orders.AddExecuteFunctionContext(execute)
+			orders.AddCheckFunctionContext("isPaid", check("orders"))
+
+			if test.cancel != nil {
+				test.cancel(cancel)
+			}
+
+			success, err := orders.ProcessTransitionContext(ctx, "paid", struct{}{})
+			if success != test.wantSuccess || (test.wantErr == nil) != (err == nil) || (test.wantErr != nil && !errors.Is(err, test.wantErr)) {
+				t.Errorf("ProcessTransitionContext = %v, %v, want %v, %T", success, err, test.wantSuccess, test.wantErr)
+			}
+			if test.wantErr != nil && !errors.Is(err, context.Canceled) {
+				t.Errorf("error = %v, want a context.Canceled", err)
+			}
+			if !reflect.DeepEqual(calls, test.wantCalls) {
+				t.Errorf("calls = %v, want %v", calls, test.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,12 @@
+package state_machine
+
+// Option configures a state machine on creation
+type Option func(sm *StateMachine)
+
+// WithValidation validates the definition on load and the handler references before processing the first transition,
+// failing with an ErrValidation instead of loading a broken definition or calling an unregistered handler
+func WithValidation() Option {
+	return func(sm *StateMachine) {
+		sm.validateOnTransition = true
+	}
+}
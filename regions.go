@@ -0,0 +1,390 @@
+package state_machine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MainRegion the region of the states declared outside of the regions of the definition
+const MainRegion = ""
+
+// RegionInput an orthogonal region, its states have their own current state next to the ones of the other regions.
+// The names of the states are unique across the regions.
+type RegionInput struct {
+	Name   string       `json:"name"`
+	States []StateInput `json:"states"`
+}
+
+// StateVector the current state of each region of a state machine, the main region has the empty name
+type StateVector map[string]string
+
+// String encodes the vector in a deterministic string, e.g. to keep it in a StateStore.
+// The empty vector is encoded as the empty state.
+func (v StateVector) String() string {
+	if len(v) == 0 {
+		return ""
+	}
+
+	data, _ := json.Marshal(map[string]string(v))
+	return string(data)
+}
+
+// ParseStateVector decodes a vector encoded by StateVector.String
+func ParseStateVector(state string) (StateVector, error) {
+	vector := make(StateVector)
+	if state == "" {
+		return vector, nil
+	}
+
+	if err := json.Unmarshal([]byte(state), &vector); err != nil {
+		return nil, fmt.Errorf("invalid state vector [%s]: %w", state, err)
+	}
+
+	return vector, nil
+}
+
+// with returns a copy of the vector with the state of the region
+func (v StateVector) with(region, state string) StateVector {
+	vector := make(StateVector, len(v)+1)
+	for key, value := range v {
+		vector[key] = value
+	}
+	vector[region] = state
+
+	return vector
+}
+
+// buildJoin builds the join condition (region: state) of a transition from its definition, nil without one
+func buildJoin(inputs []JoinInput) (map[string]string, error) {
+	if len(inputs) == 0 {
+		return nil, nil
+	}
+
+	join := make(map[string]string, len(inputs))
+	for _, input := range inputs {
+		if input.Region == MainRegion || input.State == "" {
+			return nil, fmt.Errorf("invalid join [%s=%s], expected a region and a state", input.Region, input.State)
+		}
+		if state, ok := join[input.Region]; ok && state != input.State {
+			return nil, fmt.Errorf("join of region [%s] requires both [%s] and [%s]", input.Region, state, input.State)
+		}
+		join[input.Region] = input.State
+	}
+
+	return join, nil
+}
+
+// definitionJoin rebuilds the definition of a join condition, sorted by region
+func definitionJoin(join map[string]string) (inputs []JoinInput) {
+	for _, region := range sortedKeys(join) {
+		inputs = append(inputs, JoinInput{Region: region, State: join[region]})
+	}
+
+	return inputs
+}
+
+// formatJoin formats a join condition, e.g. payment=paid, shipping=delivered
+func formatJoin(join map[string]string) string {
+	conditions := make([]string, 0, len(join))
+	for _, region := range sortedKeys(join) {
+		conditions = append(conditions, region+"="+join[region])
+	}
+
+	return strings.Join(conditions, ", ")
+}
+
+// Regions returns the orthogonal regions of the state machine in the declared order, without the main region
+func (sm *StateMachine) Regions() []string {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	return append([]string(nil), sm.regions...)
+}
+
+// RegionOf returns the region of a state, MainRegion for the states declared outside of the regions
+func (sm *StateMachine) RegionOf(state string) string {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	return sm.stateRegions[state]
+}
+
+// AddStateVectorFunction sets the function reading the state of every region of the object,
+// it replaces the current state function of a state machine with regions
+func (sm *StateMachine) AddStateVectorFunction(handler StateVectorFunc) {
+	sm.AddStateVectorFunctionContext(func(_ context.Context, obj any) (StateVector, int64, error) {
+		return handler(obj)
+	})
+}
+
+func (sm *StateMachine) AddStateVectorFunctionContext(handler StateVectorFuncContext) {
+	sm.register(func() {
+		sm.stateVector = handler
+	})
+}
+
+// AddExecuteVectorFunction sets the function writing the states of the regions of the object, it receives the vectors
+// before and after the transition. It replaces the execute function of a state machine with regions.
+func (sm *StateMachine) AddExecuteVectorFunction(handler HandlerExecVectorFunction) {
+	sm.AddExecuteVectorFunctionContext(func(_ context.Context, from, to StateVector, version int64, obj any) error {
+		return handler(from, to, version, obj)
+	})
+}
+
+func (sm *StateMachine) AddExecuteVectorFunctionContext(handler HandlerExecVectorFunctionContext) {
+	sm.register(func() {
+		sm.executeVector = handler
+	})
+}
+
+func (sm *StateMachine) hasRegions() bool {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	return len(sm.regions) > 0
+}
+
+// getRegions returns the main region followed by the declared regions
+func (sm *StateMachine) getRegions() []string {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	return append([]string{MainRegion}, sm.regions...)
+}
+
+func (sm *StateMachine) getExecuteVectorFunction() HandlerExecVectorFunctionContext {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	return sm.executeVector
+}
+
+// initialVector returns the initial state of every region, entered with the initial state of the state machine
+func (sm *StateMachine) initialVector(initialState string) StateVector {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+
+	vector := StateVector{MainRegion: initialState}
+	for _, region := range sm.regions {
+		if initial := sm.regionInitials[region]; initial != "" {
+			vector[region] = sm.leaf(initial)
+		}
+	}
+
+	return vector
+}
+
+// getRegionEntryHooks returns the on_enter hooks of the initial states of the regions, entered with the initial state
+func (sm *StateMachine) getRegionEntryHooks(vector StateVector) (hooks []OnSuccessStruct) {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+
+	for _, region := range sm.regions {
+		if vector[region] == "" {
+			continue
+		}
+
+		entered := sm.lineage(vector[region])
+		for i := len(entered) - 1; i >= 0; i-- {
+			hooks = append(hooks, sm.OnEnter[entered[i]]...)
+		}
+	}
+
+	return hooks
+}
+
+// readVector reads the state of every region of the object, with the state vector function
+// or decoded from the current state
+func (sm *StateMachine) readVector(ctx context.Context, obj any) (StateVector, int64, error) {
+	sm.mux.RLock()
+	stateVector, store := sm.stateVector, sm.stateStore
+	sm.mux.RUnlock()
+
+	if stateVector != nil && store == nil {
+		return stateVector(ctx, obj)
+	}
+
+	state, version, err := sm.readState(ctx, obj)
+	if err != nil {
+		return nil, version, err
+	}
+
+	vector, err := ParseStateVector(state)
+	return vector, version, err
+}
+
+// readRunState reads the current state of the run, in the region of its next state or of its event
+func (sm *StateMachine) readRunState(ctx context.Context, run *transitionRun, obj any) (string, error) {
+	if !sm.hasRegions() {
+		state, version, err := sm.readState(ctx, obj)
+		run.from, run.version = state, version
+		return state, err
+	}
+
+	vector, version, err := sm.readVector(ctx, obj)
+	run.fromVector, run.version = vector, version
+	if err != nil {
+		return "", err
+	}
+
+	run.region = sm.RegionOf(run.to)
+	if run.event != "" {
+		for _, region := range sm.getRegions() {
+			if _, ok := sm.getEventTarget(vector[region], run.event); ok {
+				run.region = region
+				break
+			}
+		}
+	}
+
+	run.from = vector[run.region]
+	return run.from, nil
+}
+
+// storedStates returns the states written by the run, the encoded vectors in a state machine with regions
+func (r *transitionRun) storedStates() (from, to string) {
+	if r.fromVector == nil {
+		return r.from, r.to
+	}
+
+	return r.fromVector.String(), r.toVector.String()
+}
+
+// joined checks if every region of the join is in its state, or in one of its descendants
+func (sm *StateMachine) joined(join map[string]string, vector StateVector) bool {
+	for region, state := range join {
+		if !sm.IsIn(vector[region], state) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// runJoin checks the join condition of a transition on the current states of the regions
+func (sm *StateMachine) runJoin(run *transitionRun, join map[string]string) (bool, error) {
+	if join == nil || sm.joined(join, run.fromVector) {
+		return true, nil
+	}
+
+	err := &ErrCheckRejected{Machine: run.machine, State: run.from, NextState: run.to, Check: "join(" + formatJoin(join) + ")"}
+	run.fail(transitionStageCheck, "join", err)
+	return false, err
+}
+
+// runJoins processes the first transition whose join condition holds once the region reached its next state,
+// in the transaction of the run. The join transition processes the joins that follow it. The guard and the checks
+// of a join transition are evaluated first without side effects: a rejected join transition is not joined yet,
+// the transition of the region completes without it, its on_error handlers and audit are not run.
+func (sm *StateMachine) runJoins(ctx context.Context, run *transitionRun, obj any) (bool, error) {
+	if run.toVector == nil {
+		return true, nil
+	}
+
+	for _, region := range sm.getRegions() {
+		state := run.toVector[region]
+		if state == "" {
+			continue
+		}
+
+		for _, nextState := range sm.getTransitions(state) {
+			handlers, _ := sm.getHandlers(state, nextState)
+			if handlers.Join == nil || !sm.joined(handlers.Join, run.toVector) {
+				continue
+			}
+
+			evaluation, err := sm.evaluateTransition(ctx, run.toVector, region, nextState, obj)
+			if err != nil {
+				run.fail(transitionStageJoin, nextState, err)
+				return false, err
+			}
+			if !evaluation.Allowed {
+				continue
+			}
+
+			success, err := sm.processTransitionWithRetry(run.childContext(ctx, nil), transitionRequest{nextState: nextState}, obj)
+			if errors.Is(err, &ErrCheckRejected{}) {
+				continue
+			}
+			if err != nil || !success {
+				run.fail(transitionStageJoin, nextState, err)
+			}
+			return success, err
+		}
+	}
+
+	return true, nil
+}
+
+// applyRegions adds the states of the regions of the definition, the caller must hold the lock
+func (sm *StateMachine) applyRegions(definition Definition) error {
+	for _, state := range definition.States {
+		if region, ok := sm.stateRegions[state.Name]; ok && region != MainRegion {
+			return fmt.Errorf("state [%s] of state machine [%s] is declared in the main region and in region [%s]", state.Name, sm.Name, region)
+		}
+		sm.stateRegions[state.Name] = MainRegion
+	}
+
+	for _, region := range definition.Regions {
+		if region.Name == MainRegion {
+			return fmt.Errorf("a region of state machine [%s] has no name", sm.Name)
+		}
+
+		declared := false
+		for _, name := range sm.regions {
+			declared = declared || name == region.Name
+		}
+		if !declared {
+			sm.regions = append(sm.regions, region.Name)
+		}
+
+		for _, state := range region.States {
+			if other, ok := sm.stateRegions[state.Name]; ok && other != region.Name {
+				return fmt.Errorf("state [%s] of state machine [%s] is declared in regions [%s] and [%s]", state.Name, sm.Name, other, region.Name)
+			}
+			sm.stateRegions[state.Name] = region.Name
+
+			if state.Create != nil {
+				return fmt.Errorf("state [%s] of region [%s] declares a create transition, only the initial state of the main region can", state.Name, region.Name)
+			}
+
+			if state.Initial {
+				if initial := sm.regionInitials[region.Name]; initial != "" && initial != state.Name {
+					return fmt.Errorf("region [%s] of state machine [%s] declares more than one initial state: [%s] and [%s]", region.Name, sm.Name, initial, state.Name)
+				}
+				sm.regionInitials[region.Name] = state.Name
+				state.Initial = false
+			}
+
+			if err := sm.applyState(state); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// regionStates splits the states of a definition in the main region and the other regions, the caller must hold the lock
+func (sm *StateMachine) regionStates(states []StateInput) ([]StateInput, []RegionInput) {
+	var (
+		main    []StateInput
+		regions []RegionInput
+	)
+	indexes := make(map[string]int)
+	for _, region := range sm.regions {
+		indexes[region] = len(regions)
+		regions = append(regions, RegionInput{Name: region})
+	}
+
+	for _, state := range states {
+		region := sm.stateRegions[state.Name]
+		if region == MainRegion {
+			main = append(main, state)
+			continue
+		}
+
+		state.Initial = sm.regionInitials[region] == state.Name
+		regions[indexes[region]].States = append(regions[indexes[region]].States, state)
+	}
+
+	return main, regions
+}
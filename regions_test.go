@@ -0,0 +1,99 @@
+package state_machine
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+const regionsDefinition = `{"name":"orders","states":[
+	{"name":"open","initial":true,"create":{"name":"open"},"transitions":[{"name":"completed","join":[{"region":"Payment","state":"paid"},{"region":"shipping.eu","state":"delivered"}],"check":[{"func":"canComplete"}],"on_error":[{"func":"onRejected"}]}]},
+	{"name":"completed","final":true}],
+	"regions":[
+	{"name":"Payment","states":[{"name":"unpaid","initial":true,"transitions":[{"name":"paid"}]},{"name":"paid"}]},
+	{"name":"shipping.eu","states":[{"name":"preparing","initial":true,"transitions":[{"name":"delivered"}]},{"name":"delivered"}]}]}`
+
+func TestRunJoins(t *testing.T) {
+	tests := []struct {
+		name        string
+		canComplete bool
+		want        StateVector
+		wantRecords int
+	}{
+		{name: "processes the satisfied join", canComplete: true, want: StateVector{MainRegion: "completed", "Payment": "paid", "shipping.eu": "delivered"}, wantRecords: 1},
+		{name: "keeps the region transition of a rejected join", canComplete: false, want: StateVector{MainRegion: "open", "Payment": "paid", "shipping.eu": "delivered"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := NewMemoryStateStore()
+			sink := NewMemoryAuditSink()
+			sm := NewStateMachine(WithValidation(), WithAuditSink(sink), WithStateStore(store, func(obj any) string { return obj.(string) }))
+			if err := sm.LoadFromBytes([]byte(regionsDefinition), "json"); err != nil {
+				t.Fatal(err)
+			}
+			sm.AddCheckFunction("canComplete", func(any, ...string) (bool, error) { return test.canComplete, nil })
+			onRejected := 0
+			sm.AddOnErrorFunction("onRejected", func(any, ...string) (bool, error) {
+				onRejected++
+				return true, nil
+			})
+
+			for _, step := range []func() (bool, error){
+				func() (bool, error) { return sm.ProcessInitialTransition("order-1") },
+				func() (bool, error) { return sm.ProcessTransition("delivered", "order-1") },
+				func() (bool, error) { return sm.ProcessTransition("paid", "order-1") },
+			} {
+				if success, err := step(); err != nil || !success {
+					t.Fatalf("transition = %v, %v, want true, nil", success, err)
+				}
+			}
+
+			state, _, _ := store.Get(ctx, "order-1")
+			vector, err := ParseStateVector(state)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if vector.String() != test.want.String() {
+				t.Errorf("state = %s, want %s", vector, test.want)
+			}
+			// a rejected join is evaluated without side effects
+			if onRejected != 0 {
+				t.Errorf("on_error calls = %d, want 0", onRejected)
+			}
+			if records := sink.Query(AuditQuery{To: "completed"}); len(records) != test.wantRecords {
+				t.Errorf("audit records of the join = %v, want %d", records, test.wantRecords)
+			}
+		})
+	}
+}
+
+func TestBuildJoin(t *testing.T) {
+	tests := []struct {
+		name    string
+		inputs  []JoinInput
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "no join"},
+		{name: "keeps the case and the dots of the regions", inputs: []JoinInput{{Region: "Payment", State: "paid"}, {Region: "shipping.eu", State: "delivered"}},
+			want: map[string]string{"Payment": "paid", "shipping.eu": "delivered"}},
+		{name: "same state twice", inputs: []JoinInput{{Region: "Payment", State: "paid"}, {Region: "Payment", State: "paid"}}, want: map[string]string{"Payment": "paid"}},
+		{name: "two states of a region", inputs: []JoinInput{{Region: "Payment", State: "paid"}, {Region: "Payment", State: "unpaid"}}, wantErr: true},
+		{name: "without a region", inputs: []JoinInput{{State: "paid"}}, wantErr: true},
+		{name: "without a state", inputs: []JoinInput{{Region: "Payment"}}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			join, err := buildJoin(test.inputs)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("buildJoin = %v, want error %v", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(join, test.want) {
+				t.Errorf("buildJoin = %v, want %v", join, test.want)
+			}
+		})
+	}
+}
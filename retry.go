@@ -0,0 +1,201 @@
+package state_machine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	// BackoffConstant waits the initial delay between the attempts
+	BackoffConstant = "constant"
+	// BackoffExponential doubles the delay after every attempt
+	BackoffExponential = "exponential"
+)
+
+// RetryPolicyInput the retry policy of a handler in the definition, e.g. {max: 3, backoff: exponential, initial: 100ms}
+type RetryPolicyInput struct {
+	// Max number of retries after the first attempt
+	Max int `json:"max"`
+	// Backoff constant (default) or exponential
+	Backoff string `json:"backoff,omitempty"`
+	// Initial delay before the first retry
+	Initial string `json:"initial,omitempty"`
+	// MaxDelay caps the delay of the exponential backoff
+	MaxDelay string `json:"max_delay,omitempty" mapstructure:"max_delay"`
+}
+
+// RetryPolicy retries a failing handler up to Max times, waiting between the attempts.
+// The retries run in the transaction of the transition, see TransitionInput.Retry.
+type RetryPolicy struct {
+	// Max number of retries after the first attempt
+	Max int `json:"max"`
+	// Backoff constant or exponential
+	Backoff string `json:"backoff,omitempty"`
+	// Initial delay before the first retry
+	Initial time.Duration `json:"initial,omitempty"`
+	// MaxDelay caps the delay of the exponential backoff, maxRetryDelay by default
+	MaxDelay time.Duration `json:"max_delay,omitempty"`
+}
+
+// maxRetryDelay the cap of the exponential backoff without a MaxDelay
+const maxRetryDelay = time.Hour
+
+// RetryClassifier reports whether the error of a failed handler is retryable
+type RetryClassifier func(err error) bool
+
+// buildRetryPolicy builds a retry policy from its definition, nil without one
+func buildRetryPolicy(input *RetryPolicyInput) (*RetryPolicy, error) {
+	if input == nil {
+		return nil, nil
+	}
+
+	policy := &RetryPolicy{Max: input.Max, Backoff: input.Backoff}
+	if policy.Max < 0 {
+		return nil, fmt.Errorf("invalid retry max [%d]", input.Max)
+	}
+
+	switch policy.Backoff {
+	case "":
+		policy.Backoff = BackoffConstant
+	case BackoffConstant, BackoffExponential:
+	default:
+		return nil, fmt.Errorf("invalid retry backoff [%s], expected %s or %s", input.Backoff, BackoffConstant, BackoffExponential)
+	}
+
+	if input.Initial != "" {
+		var err error
+		if policy.Initial, err = time.ParseDuration(input.Initial); err != nil || policy.Initial < 0 {
+			return nil, fmt.Errorf("invalid retry initial [%s]", input.Initial)
+		}
+	}
+
+	if input.MaxDelay != "" {
+		var err error
+		if policy.MaxDelay, err = time.ParseDuration(input.MaxDelay); err != nil || policy.MaxDelay <= 0 {
+			return nil, fmt.Errorf("invalid retry max_delay [%s]", input.MaxDelay)
+		}
+	}
+
+	if policy.Backoff == BackoffExponential && policy.Initial <= 0 {
+		return nil, fmt.Errorf("retry with the %s backoff requires a positive initial delay", BackoffExponential)
+	}
+
+	return policy, nil
+}
+
+// Input returns the definition of the retry policy
+func (p *RetryPolicy) Input() RetryPolicyInput {
+	input := RetryPolicyInput{Max: p.Max, Backoff: p.Backoff}
+	if p.Initial > 0 {
+		input.Initial = p.Initial.String()
+	}
+	if p.MaxDelay > 0 {
+		input.MaxDelay = p.MaxDelay.String()
+	}
+
+	return input
+}
+
+// delay returns the wait before the retry, the first retry is 1. The exponential backoff doubles the delay
+// up to the max delay, so it never overflows.
+func (p *RetryPolicy) delay(retry int) time.Duration {
+	if p.Backoff != BackoffExponential || p.Initial <= 0 {
+		return p.Initial
+	}
+
+	maxDelay := p.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = maxRetryDelay
+	}
+
+	delay := p.Initial
+	for i := 1; i < retry && delay < maxDelay && delay <= math.MaxInt64/2; i++ {
+		delay *= 2
+	}
+
+	if delay > maxDelay {
+		return maxDelay
+	}
+
+	return delay
+}
+
+// AddRetryPolicy sets the retry policy of the execute function and the on_success handlers without their own.
+// The lifecycle hooks (on_enter, on_exit, before_transition and after_transition) are only retried with their own.
+func (sm *StateMachine) AddRetryPolicy(policy RetryPolicy) {
+	sm.register(func() {
+		sm.retryPolicy = &policy
+	})
+}
+
+// WithRetryPolicy sets the retry policy of the execute and on_success handlers without their own
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(sm *StateMachine) {
+		sm.retryPolicy = &policy
+	}
+}
+
+// AddRetryClassifier sets the function choosing the retryable errors, every error is retryable by default.
+// Cancellations, concurrent modifications and handlers not registered are never retried.
+func (sm *StateMachine) AddRetryClassifier(classifier RetryClassifier) {
+	sm.register(func() {
+		sm.retryClassifier = classifier
+	})
+}
+
+// WithRetryClassifier sets the function choosing the retryable errors, see AddRetryClassifier
+func WithRetryClassifier(classifier RetryClassifier) Option {
+	return func(sm *StateMachine) {
+		sm.retryClassifier = classifier
+	}
+}
+
+// getRetryPolicy returns the policy, or the default one of the state machine without one
+func (sm *StateMachine) getRetryPolicy(policy *RetryPolicy) *RetryPolicy {
+	if policy != nil {
+		return policy
+	}
+
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	return sm.retryPolicy
+}
+
+func (sm *StateMachine) getRetryClassifier() RetryClassifier {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	return sm.retryClassifier
+}
+
+// retryable checks if the error of a handler can be retried
+func retryable(err error, classifier RetryClassifier) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, &ErrConcurrentModification{}) || errors.Is(err, &ErrHandlerNotRegistered{}) {
+		return false
+	}
+
+	return classifier == nil || classifier(err)
+}
+
+// retry calls the handler again while it fails with a retryable error and the policy has retries left.
+// The wait between the attempts stops when the context is done, returning the last failure.
+func (sm *StateMachine) retry(ctx context.Context, policy *RetryPolicy, handler func() (bool, error)) (success bool, err error) {
+	classifier := sm.getRetryClassifier()
+	success, err = handler()
+	for retry := 1; policy != nil && retry <= policy.Max && err != nil && retryable(err, classifier); retry++ {
+		timer := time.NewTimer(policy.delay(retry))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return success, err
+		case <-timer.C:
+		}
+
+		success, err = handler()
+	}
+
+	return success, err
+}
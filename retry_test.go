@@ -0,0 +1,171 @@
+package state_machine
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryOfTriggeredStateMachine(t *testing.T) {
+	sm := NewStateMachine()
+	err := sm.LoadFromBytes([]byte(`{"name":"orders","states":[
+		{"name":"pending","initial":true,"transitions":[{"name":"paid","on_success":[
+			{"func":"invoices","func_arg":["invoices","sent"],"is_state_machine":true,"retry":{"max":3}}]}]},
+		{"name":"paid","final":true}]}`), "json")
+	if err == nil || !strings.Contains(err.Error(), "retry of triggered state machine [invoices] is not supported") {
+		t.Errorf("LoadFromBytes = %v, want the retry of the triggered state machine rejected", err)
+	}
+
+	_, err = NewBuilder("orders").
+		State("pending").Initial().Transition("paid").Trigger("invoices", NewStateMachine(), "sent").Retry(RetryPolicy{Max: 3}).
+		State("paid").Final().
+		Definition()
+	if err == nil || !strings.Contains(err.Error(), "Retry called after Trigger") {
+		t.Errorf("Builder = %v, want the retry of the triggered state machine rejected", err)
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		retry  int
+		want   time.Duration
+	}{
+		{name: "constant", policy: RetryPolicy{Backoff: BackoffConstant, Initial: 100 * time.Millisecond}, retry: 5, want: 100 * time.Millisecond},
+		{name: "exponential first retry", policy: RetryPolicy{Backoff: BackoffExponential, Initial: 100 * time.Millisecond}, retry: 1, want: 100 * time.Millisecond},
+		{name: "exponential doubles", policy: RetryPolicy{Backoff: BackoffExponential, Initial: 100 * time.Millisecond}, retry: 4, want: 800 * time.Millisecond},
+		{name: "exponential capped by the max delay", policy: RetryPolicy{Backoff: BackoffExponential, Initial: time.Second, MaxDelay: 5 * time.Second}, retry: 10, want: 5 * time.Second},
+		{name: "exponential capped without a max delay", policy: RetryPolicy{Backoff: BackoffExponential, Initial: time.Second}, retry: 1000, want: maxRetryDelay},
+		{name: "exponential never overflows", policy: RetryPolicy{Backoff: BackoffExponential, Initial: time.Second, MaxDelay: math.MaxInt64}, retry: 1000, want: time.Second << 33},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.policy.delay(test.retry); got != test.want {
+				t.Errorf("delay(%d) = %v, want %v", test.retry, got, test.want)
+			}
+		})
+	}
+}
+
+func TestBuildRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   RetryPolicyInput
+		wantErr bool
+	}{
+		{name: "exponential", input: RetryPolicyInput{Max: 3, Backoff: BackoffExponential, Initial: "100ms", MaxDelay: "2s"}},
+		{name: "constant by default", input: RetryPolicyInput{Max: 3}},
+		{name: "unknown backoff", input: RetryPolicyInput{Max: 3, Backoff: "linear"}, wantErr: true},
+		{name: "exponential without initial delay", input: RetryPolicyInput{Max: 3, Backoff: BackoffExponential}, wantErr: true},
+		{name: "invalid max delay", input: RetryPolicyInput{Max: 3, Backoff: BackoffExponential, Initial: "1s", MaxDelay: "-1s"}, wantErr: true},
+		{name: "negative max", input: RetryPolicyInput{Max: -1}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := buildRetryPolicy(&test.input); (err != nil) != test.wantErr {
+				t.Errorf("buildRetryPolicy = %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestDefaultRetryPolicy(t *testing.T) {
+	sm := NewStateMachine(WithRetryPolicy(RetryPolicy{Max: 2}))
+	if err := sm.LoadFromBytes([]byte(`{"name":"orders","states":[
+		{"name":"pending","initial":true,"transitions":[{"name":"paid","on_success":[{"func":"notify"}]}]},
+		{"name":"paid","on_enter":[{"func":"audit"}]}]}`), "json"); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := map[string]int{}
+	failing := func(name string) HandlerFunc {
+		return func(any, ...string) (bool, error) {
+			calls[name]++
+			if calls[name] == 1 {
+				return false, errors.New("transient")
+			}
+			return true, nil
+		}
+	}
+	executes := 0
+	sm.AddCurrentStateFunction(func(any) (string, error) { return "pending", nil })
+	sm.AddExecuteFunction(func(string, any) error {
+		executes++
+		if executes == 1 {
+			return errors.New("transient")
+		}
+		return nil
+	})
+	sm.AddOnSuccessFunction("notify", failing("notify"))
+	sm.AddOnSuccessFunction("audit", func(any, ...string) (bool, error) { return true, nil })
+
+	if success, err := sm.ProcessTransition("paid", struct{}{}); err != nil || !success {
+		t.Fatalf("ProcessTransition = %v, %v, want true, nil", success, err)
+	}
+	if executes != 2 || calls["notify"] != 2 {
+		t.Errorf("execute calls = %d, notify calls = %d, want 2 and 2", executes, calls["notify"])
+	}
+
+	// the lifecycle hooks are not retried with the default policy
+	executes = 1
+	sm.AddOnSuccessFunction("audit", failing("audit"))
+	if success, err := sm.ProcessTransition("paid", struct{}{}); err == nil || success {
+		t.Fatalf("ProcessTransition = %v, %v, want the on_enter failure", success, err)
+	}
+	if calls["audit"] != 1 {
+		t.Errorf("on_enter calls = %d, want 1", calls["audit"])
+	}
+}
+
+func TestRetryClassifier(t *testing.T) {
+	errTransient, errFatal := errors.New("transient"), errors.New("fatal")
+
+	tests := []struct {
+		name      string
+		err       error
+		wantCalls int
+	}{
+		{name: "retries the retryable errors", err: errTransient, wantCalls: 4},
+		{name: "does not retry the other errors", err: errFatal, wantCalls: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sm := NewStateMachine(WithRetryClassifier(func(err error) bool { return errors.Is(err, errTransient) }))
+			if err := sm.LoadFromBytes([]byte(`{"name":"orders","states":[
+				{"name":"pending","initial":true,"transitions":[{"name":"paid","retry":{"max":3,"backoff":"exponential","initial":"1ms"}}]},
+				{"name":"paid","final":true}]}`), "json"); err != nil {
+				t.Fatal(err)
+			}
+
+			calls := 0
+			sm.AddCurrentStateFunction(func(any) (string, error) { return "pending", nil })
+			sm.AddExecuteFunction(func(string, any) error {
+				calls++
+				return test.err
+			})
+
+			if _, err := sm.ProcessTransition("paid", struct{}{}); !errors.Is(err, test.err) {
+				t.Errorf("ProcessTransition = %v, want %v", err, test.err)
+			}
+			if calls != test.wantCalls {
+				t.Errorf("execute calls = %d, want %d", calls, test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestBuilderRetryMisuse(t *testing.T) {
+	_, err := NewBuilder("orders").
+		State("pending").Initial().Transition("paid").Check("isPaid").Retry(RetryPolicy{Max: 3}).
+		State("paid").Final().
+		Definition()
+	if err == nil || !strings.Contains(err.Error(), "Retry called after a check handler") {
+		t.Errorf("Builder = %v, want the retry of a check rejected", err)
+	}
+}
@@ -0,0 +1,133 @@
+package state_machine
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Transition stages
+const (
+	transitionStageCurrentState = "current_state"
+	transitionStageCheck        = "check"
+	transitionStageExecute      = "execute"
+	transitionStageOnSuccess    = "on_success"
+	transitionStageOnError      = "on_error"
+	transitionStageBegin        = "begin"
+	transitionStageCommit       = "commit"
+	transitionStageJoin         = "join"
+	transitionStageSchedule     = "schedule"
+	// lifecycle hooks
+	transitionStageBeforeTransition = "before_transition"
+	transitionStageAfterTransition  = "after_transition"
+	transitionStageOnEnter          = "on_enter"
+	transitionStageOnExit           = "on_exit"
+)
+
+// lifecycleHooks the lifecycle hooks of a transition
+type lifecycleHooks struct {
+	beforeTransition []OnSuccessStruct
+	onExit           []OnSuccessStruct
+	onEnter          []OnSuccessStruct
+	afterTransition  []OnSuccessStruct
+}
+
+// lifecycleStage a stage of on_success like handlers
+type lifecycleStage struct {
+	name     string
+	handlers []OnSuccessStruct
+}
+
+// transitionRun the state of a single transition attempt
+type transitionRun struct {
+	// machine
+	machine string
+	// from state, empty on the initial transition
+	from string
+	// to state
+	to string
+	// event that fired the transition
+	event string
+	// within the state the object must still be in, for a scheduled transition
+	within string
+	// region of the from and to states
+	region string
+	// fromVector the states of the regions before the transition, nil without regions
+	fromVector StateVector
+	// toVector the states of the regions after the transition
+	toVector StateVector
+	// version of the from state read from the state store
+	version int64
+	// obj
+	obj any
+	// parent transition when triggered by another state machine
+	parent *AuditParent
+	// startedAt
+	startedAt time.Time
+	// notAllowed the transition is not defined or leaves a final state
+	notAllowed bool
+	// failedStage the stage of the first failure
+	failedStage string
+	// failedHandler the handler of the first failure
+	failedHandler string
+	// err the error of the first failure
+	err error
+	// compensations of the completed on_success handlers
+	compensations []compensation
+	// retryConflict the transition is processed again when its write conflicts
+	retryConflict bool
+}
+
+// transitionRequest the transition to process, to a next state or for an event
+type transitionRequest struct {
+	nextState string
+	event     string
+	// within the state the object must still be in, the transition is skipped otherwise
+	within string
+}
+
+type transitionRunParentKey struct{}
+
+func (sm *StateMachine) newTransitionRun(ctx context.Context, from, to string, obj any) *transitionRun {
+	run := &transitionRun{
+		machine:   sm.GetName(),
+		from:      from,
+		to:        to,
+		obj:       obj,
+		startedAt: time.Now(),
+	}
+
+	if parent, ok := ctx.Value(transitionRunParentKey{}).(*AuditParent); ok {
+		run.parent = parent
+	}
+
+	return run
+}
+
+// fail keeps the first failure of the run
+func (r *transitionRun) fail(stage, handler string, err error) {
+	if r.failedStage != "" {
+		return
+	}
+
+	r.failedStage = stage
+	r.failedHandler = handler
+	r.err = err
+}
+
+// conflicted the write of the run failed with an ErrConcurrentModification
+func (r *transitionRun) conflicted() bool {
+	var conflict *ErrConcurrentModification
+	return r.failedStage == transitionStageExecute && errors.As(r.err, &conflict)
+}
+
+// childContext the context given to the state machines triggered by the run,
+// the collector receives their compensations when they have to be reverted
+func (r *transitionRun) childContext(ctx context.Context, collector *compensationCollector) context.Context {
+	ctx = context.WithValue(ctx, compensationCollectorKey{}, collector)
+	return context.WithValue(ctx, transitionRunParentKey{}, &AuditParent{
+		Machine: r.machine,
+		From:    r.from,
+		To:      r.to,
+	})
+}
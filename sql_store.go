@@ -0,0 +1,109 @@
+package state_machine
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// SQLPlaceholder returns the placeholder of the n-th (from 1) parameter of a query
+type SQLPlaceholder func(n int) string
+
+// QuestionPlaceholder the ? placeholders of MySQL and SQLite
+func QuestionPlaceholder(int) string {
+	return "?"
+}
+
+// DollarPlaceholder the $1, $2, ... placeholders of PostgreSQL
+func DollarPlaceholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+// SQLStateStore a StateStore in a database/sql table with the columns id (its primary key), state and version (an integer).
+// Within a database/sql transaction of the transition (see SQLTxManager) the store reads and writes in it,
+// so the state is rolled back with the rest of the transition.
+type SQLStateStore struct {
+	db          *sql.DB
+	selectQuery string
+	insertQuery string
+	updateQuery string
+}
+
+// sqlQuerier the queries shared by *sql.DB and *sql.Tx
+type sqlQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// NewSQLStateStore creates a state store in the table of the database, the table name is not escaped.
+// The placeholder defaults to QuestionPlaceholder.
+func NewSQLStateStore(db *sql.DB, table string, placeholder SQLPlaceholder) *SQLStateStore {
+	if placeholder == nil {
+		placeholder = QuestionPlaceholder
+	}
+
+	return &SQLStateStore{
+		db: db,
+		selectQuery: fmt.Sprintf("SELECT state, version FROM %s WHERE id = %s",
+			table, placeholder(1)),
+		insertQuery: fmt.Sprintf("INSERT INTO %s (id, state, version) VALUES (%s, %s, 1)",
+			table, placeholder(1), placeholder(2)),
+		updateQuery: fmt.Sprintf("UPDATE %s SET state = %s, version = version + 1 WHERE id = %s AND state = %s AND version = %s",
+			table, placeholder(1), placeholder(2), placeholder(3), placeholder(4)),
+	}
+}
+
+func (s *SQLStateStore) Get(ctx context.Context, id string) (state string, version int64, err error) {
+	err = s.querier(ctx).QueryRowContext(ctx, s.selectQuery, id).Scan(&state, &version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", 0, nil
+	}
+
+	return state, version, err
+}
+
+// CompareAndSet creates the row of the object from an empty state at version 0, otherwise updates it.
+// A creation failing on the primary key of a row created concurrently is reported as not set, the row is read
+// again to tell it from the other errors. Within a transaction of a database aborting it on a failed statement
+// (e.g. Postgres) the row can't be read, the error of the creation is returned.
+func (s *SQLStateStore) CompareAndSet(ctx context.Context, id, from, to string, version int64) (bool, error) {
+	if from == "" && version == 0 {
+		return s.create(ctx, id, to)
+	}
+
+	result, err := s.querier(ctx).ExecContext(ctx, s.updateQuery, to, id, from, version)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows == 1, nil
+}
+
+// create inserts the row of the object, reporting false when it already has one
+func (s *SQLStateStore) create(ctx context.Context, id, state string) (bool, error) {
+	_, err := s.querier(ctx).ExecContext(ctx, s.insertQuery, id, state)
+	if err == nil {
+		return true, nil
+	}
+
+	if _, version, getErr := s.Get(ctx, id); getErr == nil && version > 0 {
+		return false, nil
+	}
+
+	return false, err
+}
+
+func (s *SQLStateStore) querier(ctx context.Context) sqlQuerier {
+	if tx, ok := SQLTxFromContext(ctx); ok {
+		return tx
+	}
+
+	return s.db
+}
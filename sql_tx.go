@@ -0,0 +1,35 @@
+package state_machine
+
+import (
+	"context"
+	"database/sql"
+)
+
+// SQLTxManager begins the transactions of the transitions in a database/sql database
+type SQLTxManager struct {
+	db   *sql.DB
+	opts *sql.TxOptions
+}
+
+// NewSQLTxManager creates a transaction manager for the database, opts may be nil
+func NewSQLTxManager(db *sql.DB, opts *sql.TxOptions) *SQLTxManager {
+	return &SQLTxManager{
+		db:   db,
+		opts: opts,
+	}
+}
+
+func (m *SQLTxManager) Begin(ctx context.Context) (Tx, error) {
+	return m.db.BeginTx(ctx, m.opts)
+}
+
+// SQLTxFromContext returns the database/sql transaction of the transition running the handler
+func SQLTxFromContext(ctx context.Context) (*sql.Tx, bool) {
+	tx, ok := TxFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+
+	sqlTx, ok := tx.(*sql.Tx)
+	return sqlTx, ok
+}
@@ -0,0 +1,304 @@
+package state_machine
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDriver a database/sql driver recording the statements of its connections.
+// The statements on the table of a SQLStateStore (SELECT, INSERT and UPDATE) run on its rows.
+type fakeDriver struct {
+	mux  sync.Mutex
+	log  []string
+	rows map[string]fakeRow
+}
+
+// fakeRow a row of the table of a SQLStateStore
+type fakeRow struct {
+	state   string
+	version int64
+}
+
+// run runs a statement of a SQLStateStore on the rows of the driver
+func (d *fakeDriver) run(query string, args []driver.Value) (rows int64, selected *fakeRow, err error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if d.rows == nil {
+		d.rows = make(map[string]fakeRow)
+	}
+	arg := func(n int) string { return fmt.Sprint(args[n]) }
+
+	switch {
+	case strings.HasPrefix(query, "SELECT state, version"):
+		if row, ok := d.rows[arg(0)]; ok {
+			return 0, &row, nil
+		}
+		return 0, nil, nil
+	case strings.HasPrefix(query, "INSERT INTO"):
+		if _, ok := d.rows[arg(0)]; ok {
+			return 0, nil, errors.New("fake driver: duplicate key")
+		}
+		d.rows[arg(0)] = fakeRow{state: arg(1), version: 1}
+		return 1, nil, nil
+	case strings.Contains(query, "version = version + 1"):
+		row, ok := d.rows[arg(1)]
+		if !ok || row.state != arg(2) || fmt.Sprint(row.version) != arg(3) {
+			return 0, nil, nil
+		}
+		d.rows[arg(1)] = fakeRow{state: arg(0), version: row.version + 1}
+		return 1, nil, nil
+	default:
+		return 1, nil, nil
+	}
+}
+
+func (d *fakeDriver) record(entry string) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.log = append(d.log, entry)
+}
+
+func (d *fakeDriver) entries() []string {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	return append([]string(nil), d.log...)
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) { return &fakeConn{driver: d}, nil }
+
+type fakeConn struct {
+	driver *fakeDriver
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{driver: c.driver, query: query}, nil
+}
+func (c *fakeConn) Close() error { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.driver.record("begin")
+	return &fakeTx{driver: c.driver}, nil
+}
+
+type fakeTx struct {
+	driver *fakeDriver
+}
+
+func (tx *fakeTx) Commit() error {
+	tx.driver.record("commit")
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.driver.record("rollback")
+	return nil
+}
+
+type fakeStmt struct {
+	driver *fakeDriver
+	query  string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.driver.record(s.query)
+	rows, _, err := s.driver.run(s.query, args)
+	return driver.RowsAffected(rows), err
+}
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.driver.record(s.query)
+	_, row, err := s.driver.run(s.query, args)
+	return &fakeRows{row: row}, err
+}
+
+// fakeRows the state and the version selected by a SQLStateStore, if any
+type fakeRows struct {
+	row *fakeRow
+}
+
+func (r *fakeRows) Columns() []string { return []string{"state", "version"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.row == nil {
+		return io.EOF
+	}
+	dest[0], dest[1] = r.row.state, r.row.version
+	r.row = nil
+	return nil
+}
+
+// fakeDriverCount names the drivers, a driver is registered once per name
+var fakeDriverCount int
+
+func openFakeDB(t *testing.T) (*sql.DB, *fakeDriver) {
+	t.Helper()
+
+	fakeDriverCount++
+	name := fmt.Sprintf("state-machine-fake-%d", fakeDriverCount)
+	fake := &fakeDriver{}
+	sql.Register(name, fake)
+
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	return db, fake
+}
+
+func TestSQLTxManager(t *testing.T) {
+	tests := []struct {
+		name      string
+		onSuccess HandlerFunc
+		wantOk    bool
+		wantLog   []string
+	}{
+		{
+			name:      "commits a successful transition",
+			onSuccess: func(any, ...string) (bool, error) { return true, nil },
+			wantOk:    true,
+			wantLog:   []string{"begin", "UPDATE orders SET state = ?", "commit"},
+		},
+		{
+			name:      "rolls back a failing on_success",
+			onSuccess: func(any, ...string) (bool, error) { return false, errors.New("notify failed") },
+			wantOk:    false,
+			wantLog:   []string{"begin", "UPDATE orders SET state = ?", "rollback"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, fake := openFakeDB(t)
+
+			sm := NewStateMachine(WithTxManager(NewSQLTxManager(db, nil)))
+			if err := sm.LoadFromBytes([]byte(`{"name":"orders","states":[
+				{"name":"pending","initial":true,"transitions":[{"name":"paid","on_success":[{"func":"notify"}]}]},
+				{"name":"paid","final":true}]}`), "json"); err != nil {
+				t.Fatal(err)
+			}
+			sm.AddCurrentStateFunction(func(any) (string, error) { return "pending", nil })
+			sm.AddExecuteFunctionContext(func(ctx context.Context, nextState string, _ any) error {
+				tx, ok := SQLTxFromContext(ctx)
+				if !ok {
+					return errors.New("execute runs without a transaction")
+				}
+				_, err := tx.ExecContext(ctx, "UPDATE orders SET state = ?", nextState)
+				return err
+			})
+			sm.AddOnSuccessFunction("notify", test.onSuccess)
+
+			ok, err := sm.ProcessTransition("paid", struct{}{})
+			if ok != test.wantOk || (err == nil) != test.wantOk {
+				t.Fatalf("ProcessTransition = %v, %v, want success %v", ok, err, test.wantOk)
+			}
+			if got := fake.entries(); !reflect.DeepEqual(got, test.wantLog) {
+				t.Errorf("statements = %v, want %v", got, test.wantLog)
+			}
+		})
+	}
+}
+
+func TestSQLStateStore(t *testing.T) {
+	db, fake := openFakeDB(t)
+	store := NewSQLStateStore(db, "orders", nil)
+	ctx := context.Background()
+
+	steps := []struct {
+		name        string
+		from, to    string
+		version     int64
+		wantSwapped bool
+		wantState   string
+		wantVersion int64
+	}{
+		{name: "creates the row", to: "pending", wantSwapped: true, wantState: "pending", wantVersion: 1},
+		{name: "creates an existing row", to: "paid", wantState: "pending", wantVersion: 1},
+		{name: "updates the row", from: "pending", to: "paid", version: 1, wantSwapped: true, wantState: "paid", wantVersion: 2},
+		{name: "updates from a stale version", from: "paid", to: "shipped", version: 1, wantState: "paid", wantVersion: 2},
+		{name: "updates from another state", from: "pending", to: "shipped", version: 2, wantState: "paid", wantVersion: 2},
+	}
+
+	for _, step := range steps {
+		swapped, err := store.CompareAndSet(ctx, "order-1", step.from, step.to, step.version)
+		if swapped != step.wantSwapped || err != nil {
+			t.Errorf("%s: CompareAndSet = %v, %v, want %v", step.name, swapped, err, step.wantSwapped)
+		}
+
+		state, version, err := store.Get(ctx, "order-1")
+		if state != step.wantState || version != step.wantVersion || err != nil {
+			t.Errorf("%s: Get = %s, %d, %v, want %s, %d", step.name, state, version, err, step.wantState, step.wantVersion)
+		}
+	}
+
+	if state, version, err := store.Get(ctx, "order-2"); state != "" || version != 0 || err != nil {
+		t.Errorf("Get of a missing row = %q, %d, %v, want the empty state at version 0", state, version, err)
+	}
+
+	if entries := fake.entries(); !reflect.DeepEqual(entries[:2], []string{
+		"INSERT INTO orders (id, state, version) VALUES (?, ?, 1)",
+		"SELECT state, version FROM orders WHERE id = ?",
+	}) {
+		t.Errorf("statements = %v, want the insert of the row", entries)
+	}
+}
+
+func TestSQLStateStorePlaceholders(t *testing.T) {
+	store := NewSQLStateStore(nil, "orders", DollarPlaceholder)
+
+	want := []string{
+		"SELECT state, version FROM orders WHERE id = $1",
+		"INSERT INTO orders (id, state, version) VALUES ($1, $2, 1)",
+		"UPDATE orders SET state = $1, version = version + 1 WHERE id = $2 AND state = $3 AND version = $4",
+	}
+	if queries := []string{store.selectQuery, store.insertQuery, store.updateQuery}; !reflect.DeepEqual(queries, want) {
+		t.Errorf("queries = %v, want %v", queries, want)
+	}
+}
+
+func TestStateStoreConcurrentModification(t *testing.T) {
+	db, _ := openFakeDB(t)
+	stores := map[string]StateStore{
+		"memory": NewMemoryStateStore(),
+		"sql":    NewSQLStateStore(db, "orders", nil),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			sm := NewStateMachine(WithStateStore(store, func(any) string { return "order-1" }))
+			if err := sm.LoadFromBytes([]byte(`{"name":"orders","states":[
+				{"name":"pending","initial":true,"transitions":[{"name":"paid","check":[{"func":"isPaid"}]}]},
+				{"name":"paid","final":true}]}`), "json"); err != nil {
+				t.Fatal(err)
+			}
+			// another worker moves the object between the read and the write of the transition
+			sm.AddCheckFunction("isPaid", func(any, ...string) (bool, error) {
+				return store.CompareAndSet(context.Background(), "order-1", "pending", "paid", 1)
+			})
+
+			if success, err := sm.ProcessInitialTransition(struct{}{}); !success || err != nil {
+				t.Fatalf("ProcessInitialTransition = %v, %v, want a success", success, err)
+			}
+
+			success, err := sm.ProcessTransition("paid", struct{}{})
+			var conflict *ErrConcurrentModification
+			if success || !errors.As(err, &conflict) || conflict.ObjectId != "order-1" || conflict.Version != 1 {
+				t.Errorf("ProcessTransition = %v, %v, want an ErrConcurrentModification of version 1", success, err)
+			}
+
+			if state, version, _ := store.Get(context.Background(), "order-1"); state != "paid" || version != 2 {
+				t.Errorf("stored state = %s, %d, want the one of the other worker: paid, 2", state, version)
+			}
+		})
+	}
+}
@@ -1,15 +1,23 @@
 package state_machine
 
 import (
-	"bitbucket.org/asadventure/be-infrastructure-lib/errors"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
+	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 )
 
-func NewStateMachine() IStateMachine {
-	return &StateMachine{
+func NewStateMachine(opts ...Option) *StateMachine {
+	sm := &StateMachine{
 		MapStates:                 make(map[string]map[string]Handlers),
 		stateMachinesToTriggerMap: make(map[string]IStateMachine),
 		CheckHandlers:             make(map[string]HandlerFunc),
@@ -17,202 +25,1124 @@ func NewStateMachine() IStateMachine {
 		OnErrorHandlers:           make(map[string]HandlerFunc),
 		AdapterHandlers:           make(map[string]HandlerAdapterFunction),
 		FilterHandlers:            make(map[string]HandlerFilterFunction),
+		CompensateHandlers:        make(map[string]HandlerFunc),
+		checkHandlers:             make(map[string]HandlerFuncContext),
+		onSuccessHandlers:         make(map[string]HandlerFuncContext),
+		onErrorHandlers:           make(map[string]HandlerFuncContext),
+		adapterHandlers:           make(map[string]HandlerAdapterFunctionContext),
+		filterHandlers:            make(map[string]HandlerFilterFunctionContext),
+		compensateHandlers:        make(map[string]HandlerFuncContext),
+		OnEnter:                   make(map[string][]OnSuccessStruct),
+		OnExit:                    make(map[string][]OnSuccessStruct),
+		finalStates:               make(map[string]bool),
+		events:                    make(map[string]map[string]string),
+		parents:                   make(map[string]string),
+		initialChildren:           make(map[string]string),
+		stateRegions:              make(map[string]string),
+		regionInitials:            make(map[string]string),
 	}
+
+	for _, opt := range opts {
+		opt(sm)
+	}
+
+	return sm
 }
 
 func (sm *StateMachine) Load(filePath string) error {
-	// Read the JSON file
-	file, err := os.Open(filePath)
+	// Read the definition file
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	return sm.LoadFromBytes(data, definitionFormat(filePath))
+}
+
+// LoadFromFS loads the definition from a file system, e.g. an embed.FS
+func (sm *StateMachine) LoadFromFS(fsys fs.FS, filePath string) error {
+	data, err := fs.ReadFile(fsys, filePath)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	//var test any
-	viper.SetConfigFile(filePath)
+	return sm.LoadFromBytes(data, definitionFormat(filePath))
+}
+
+// LoadFromBytes loads the definition in the given format (json, yaml, toml, ...)
+func (sm *StateMachine) LoadFromBytes(data []byte, format string) error {
+	return sm.LoadFromReader(bytes.NewReader(data), format)
+}
+
+// LoadFromReader loads the definition in the given format (json, yaml, toml, ...)
+func (sm *StateMachine) LoadFromReader(reader io.Reader, format string) error {
+	// an isolated decoder, so the global viper configuration is never touched
+	decoder := viper.New()
+	decoder.SetConfigType(format)
+
+	if err := decoder.ReadConfig(reader); err != nil {
+		return err
+	}
 
-	if err = viper.ReadInConfig(); err != nil {
+	var definition Definition
+	decodeHook := viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		guardInputDecodeHook,
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+	))
+	if err := decoder.Unmarshal(&definition, decodeHook); err != nil {
 		return err
 	}
 
-	if err = viper.Unmarshal(&sm); err != nil {
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+
+	if sm.frozen {
+		return &ErrFrozen{Machine: sm.Name}
+	}
+
+	return sm.applyDefinition(definition)
+}
+
+// applyDefinition replaces the definition of the state machine, the caller must hold the lock.
+// The definition is built into fresh maps first, so a failed load keeps the previous definition.
+func (sm *StateMachine) applyDefinition(definition Definition) error {
+	loaded := &StateMachine{
+		MapStates:       make(map[string]map[string]Handlers),
+		OnEnter:         make(map[string][]OnSuccessStruct),
+		OnExit:          make(map[string][]OnSuccessStruct),
+		finalStates:     make(map[string]bool),
+		events:          make(map[string]map[string]string),
+		parents:         make(map[string]string),
+		initialChildren: make(map[string]string),
+		stateRegions:    make(map[string]string),
+		regionInitials:  make(map[string]string),
+	}
+	if err := loaded.buildDefinition(definition); err != nil {
 		return err
 	}
+	if sm.validateOnTransition {
+		if err := loaded.validateDefinition(); err != nil {
+			return err
+		}
+	}
+
+	sm.Name = loaded.Name
+	sm.States = loaded.States
+	sm.MapStates = loaded.MapStates
+	sm.OnEnter = loaded.OnEnter
+	sm.OnExit = loaded.OnExit
+	sm.BeforeTransition = loaded.BeforeTransition
+	sm.AfterTransition = loaded.AfterTransition
+	sm.initialState = loaded.initialState
+	sm.initialHandlers = loaded.initialHandlers
+	sm.finalStates = loaded.finalStates
+	sm.events = loaded.events
+	sm.parents = loaded.parents
+	sm.initialChildren = loaded.initialChildren
+	sm.regions = loaded.regions
+	sm.stateRegions = loaded.stateRegions
+	sm.regionInitials = loaded.regionInitials
+	sm.validated = false
+
+	return nil
+}
+
+// buildDefinition initializes the definition of an empty state machine
+func (sm *StateMachine) buildDefinition(definition Definition) error {
+	sm.Name = definition.Name
+	sm.States = definition.States
+	var err error
+	if sm.BeforeTransition, err = buildOnSuccessHandlers(definition.BeforeTransition); err != nil {
+		return fmt.Errorf("before_transition: %w", err)
+	}
+	if sm.AfterTransition, err = buildOnSuccessHandlers(definition.AfterTransition); err != nil {
+		return fmt.Errorf("after_transition: %w", err)
+	}
 
 	// initialize the state machine
 	for _, state := range sm.States {
-
-		if sm.MapStates[state.Name] == nil {
-			sm.MapStates[state.Name] = make(map[string]Handlers)
+		if err := sm.applyState(state); err != nil {
+			return err
 		}
+	}
 
-		for _, transition := range state.Transitions {
-			var handlers Handlers
-			// add check handlers
-			for _, check := range transition.Check {
-				funcName, args := splitFunctionAndArguments(check.Func)
-				handlers.Check = append(handlers.Check, CheckStruct{
-					Func:    funcName,
-					FuncArg: args,
-				})
+	if err := sm.applyRegions(definition); err != nil {
+		return err
+	}
+
+	// the states of the regions follow the ones of the main region
+	for _, region := range definition.Regions {
+		sm.States = append(sm.States, region.States...)
+	}
+
+	return sm.applyHierarchy()
+}
+
+// applyState initializes a state and its transitions, the caller must hold the lock
+func (sm *StateMachine) applyState(state StateInput) error {
+	if sm.MapStates[state.Name] == nil {
+		sm.MapStates[state.Name] = make(map[string]Handlers)
+	}
+
+	if state.Initial {
+		if sm.initialState != "" && sm.initialState != state.Name {
+			return fmt.Errorf("state machine [%s] declares more than one initial state: [%s] and [%s]", sm.Name, sm.initialState, state.Name)
+		}
+		sm.initialState = state.Name
+		if state.Create != nil {
+			handlers, err := buildHandlers(*state.Create)
+			if err != nil {
+				return fmt.Errorf("create of state [%s]: %w", state.Name, err)
 			}
-			// add on_success handlers
-			for _, onSuccess := range transition.OnSuccess {
-				funcName, args := splitFunctionAndArguments(onSuccess.Func)
-				handlers.OnSuccess = append(handlers.OnSuccess, OnSuccessStruct{
-					Func:            funcName,
-					FuncArg:         args,
-					Adapter:         onSuccess.Adapter,
-					Filter:          onSuccess.Filter,
-					IsStateMachine:  onSuccess.IsStateMachine,
-					IgnoreError:     onSuccess.IgnoreError,
-					IgnoreNoSuccess: onSuccess.IgnoreNoSuccess,
-				})
+			sm.initialHandlers = handlers
+		}
+	}
+
+	if state.Final {
+		sm.finalStates[state.Name] = true
+	}
+
+	if state.Parent != "" {
+		sm.parents[state.Name] = state.Parent
+	}
+
+	if state.InitialChild != "" {
+		sm.initialChildren[state.Name] = state.InitialChild
+	}
+
+	var err error
+	if len(state.OnEnter) > 0 {
+		if sm.OnEnter[state.Name], err = buildOnSuccessHandlers(state.OnEnter); err != nil {
+			return fmt.Errorf("on_enter of state [%s]: %w", state.Name, err)
+		}
+	}
+
+	if len(state.OnExit) > 0 {
+		if sm.OnExit[state.Name], err = buildOnSuccessHandlers(state.OnExit); err != nil {
+			return fmt.Errorf("on_exit of state [%s]: %w", state.Name, err)
+		}
+	}
+
+	for _, transition := range state.Transitions {
+		handlers, err := buildHandlers(transition)
+		if err != nil {
+			return fmt.Errorf("transition [%s] -> [%s]: %w", state.Name, transition.Name, err)
+		}
+		sm.MapStates[state.Name][transition.Name] = handlers
+
+		if transition.Event != "" {
+			if target, ok := sm.events[state.Name][transition.Event]; ok && target != transition.Name {
+				return fmt.Errorf("event [%s] of state [%s] targets both [%s] and [%s]", transition.Event, state.Name, target, transition.Name)
 			}
-			// add on_error handlers
-			for _, onError := range transition.OnError {
-				funcName, args := splitFunctionAndArguments(onError.Func)
-				handlers.OnError = append(handlers.OnError, OnErrorStruct{
-					Func:    funcName,
-					FuncArg: args,
-				})
+			if sm.events[state.Name] == nil {
+				sm.events[state.Name] = make(map[string]string)
 			}
-
-			sm.MapStates[state.Name][transition.Name] = handlers
+			sm.events[state.Name][transition.Event] = transition.Name
 		}
 	}
 
 	return nil
 }
 
+// definitionFormat gets the format of a definition file from its extension
+func definitionFormat(filePath string) string {
+	return strings.TrimPrefix(filepath.Ext(filePath), ".")
+}
+
+// buildHandlers builds the handlers of a transition from its definition
+func buildHandlers(transition TransitionInput) (handlers Handlers, err error) {
+	handlers.Event = transition.Event
+	if handlers.Join, err = buildJoin(transition.Join); err != nil {
+		return handlers, err
+	}
+	// add after
+	if transition.After != "" {
+		if handlers.After, err = time.ParseDuration(transition.After); err != nil || handlers.After <= 0 {
+			return handlers, fmt.Errorf("invalid after [%s] of the transition to [%s]", transition.After, transition.Name)
+		}
+	}
+	// add retry
+	if handlers.Retry, err = buildRetryPolicy(transition.Retry); err != nil {
+		return handlers, err
+	}
+	// add guard
+	if handlers.Guard, err = buildGuard(transition.Guard); err != nil {
+		return handlers, err
+	}
+	// add check handlers
+	if handlers.Check, err = buildCheckHandlers(transition.Check); err != nil {
+		return handlers, err
+	}
+	// add on_success handlers
+	if handlers.OnSuccess, err = buildOnSuccessHandlers(transition.OnSuccess); err != nil {
+		return handlers, err
+	}
+	// add on_error handlers
+	for _, onError := range transition.OnError {
+		funcName, args := splitFunctionAndArgumentsInput(onError.Func, onError.FuncArg)
+		handlers.OnError = append(handlers.OnError, OnErrorStruct{
+			Func:            funcName,
+			FuncArg:         args,
+			IgnoreError:     onError.IgnoreError,
+			IgnoreNoSuccess: onError.IgnoreNoSuccess,
+		})
+	}
+
+	return handlers, nil
+}
+
+// buildCheckHandlers builds the check handlers, with their all/any/not groups, from their definition
+func buildCheckHandlers(inputs []CheckInputStruct) (handlers []CheckStruct, err error) {
+	for _, input := range inputs {
+		check, err := buildCheckHandler(input)
+		if err != nil {
+			return nil, err
+		}
+		handlers = append(handlers, check)
+	}
+
+	return handlers, nil
+}
+
+func buildCheckHandler(input CheckInputStruct) (check CheckStruct, err error) {
+	groups := 0
+	for _, set := range []bool{input.Func != "", len(input.All) > 0, len(input.Any) > 0, input.Not != nil} {
+		if set {
+			groups++
+		}
+	}
+	if groups != 1 {
+		return check, fmt.Errorf("a check must have exactly one of func, all, any or not")
+	}
+
+	check = CheckStruct{
+		IgnoreError:     input.IgnoreError,
+		IgnoreNoSuccess: input.IgnoreNoSuccess,
+	}
+
+	switch {
+	case input.Func != "":
+		check.Func, check.FuncArg = splitFunctionAndArgumentsInput(input.Func, input.FuncArg)
+	case input.Not != nil:
+		not, err := buildCheckHandler(*input.Not)
+		if err != nil {
+			return check, err
+		}
+		check.Not = &not
+	default:
+		if check.All, err = buildCheckHandlers(input.All); err != nil {
+			return check, err
+		}
+		if check.Any, err = buildCheckHandlers(input.Any); err != nil {
+			return check, err
+		}
+	}
+
+	return check, nil
+}
+
+// buildOnSuccessHandlers builds on_success like handlers (on_success, on_enter, on_exit, ...) from their definition
+func buildOnSuccessHandlers(inputs []OnSuccessInputStruct) (handlers []OnSuccessStruct, err error) {
+	for _, onSuccess := range inputs {
+		funcName, args := splitFunctionAndArgumentsInput(onSuccess.Func, onSuccess.FuncArg)
+		compensate, compensateArgs := splitFunctionAndArguments(onSuccess.Compensate)
+		retry, err := buildRetryPolicy(onSuccess.Retry)
+		if err != nil {
+			return nil, fmt.Errorf("%w of handler [%s]", err, funcName)
+		}
+		if retry != nil && onSuccess.IsStateMachine {
+			return nil, fmt.Errorf("retry of triggered state machine [%s] is not supported, the triggered transition has its own retries", funcName)
+		}
+		handlers = append(handlers, OnSuccessStruct{
+			Func:            funcName,
+			FuncArg:         args,
+			Adapter:         onSuccess.Adapter,
+			Filter:          onSuccess.Filter,
+			IsStateMachine:  onSuccess.IsStateMachine,
+			Compensate:      compensate,
+			CompensateArg:   compensateArgs,
+			Retry:           retry,
+			IgnoreError:     onSuccess.IgnoreError,
+			IgnoreNoSuccess: onSuccess.IgnoreNoSuccess,
+		})
+	}
+
+	return handlers, nil
+}
+
+// splitFunctionAndArgumentsInput uses the explicit arguments when given,
+// otherwise the arguments are parsed from the function, e.g. func(arg1, arg2)
+func splitFunctionAndArgumentsInput(input string, args []string) (function string, arguments []string) {
+	if len(args) > 0 {
+		return input, args
+	}
+
+	return splitFunctionAndArguments(input)
+}
+
 func (sm *StateMachine) GetName() string {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
 	return sm.Name
 }
 
+func (sm *StateMachine) GetInitialState() string {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	return sm.initialState
+}
+
+func (sm *StateMachine) GetFinalStates() []string {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	return sortedKeys(sm.finalStates)
+}
+
+func (sm *StateMachine) IsFinalState(state string) bool {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	return sm.finalStates[state]
+}
+
+// Freeze makes the state machine immutable, any later registration panics with an ErrFrozen and any later load
+// returns it. The handlers set directly in the exported maps (e.g. CheckHandlers) are taken when freezing,
+// the later changes of the maps are ignored.
+// A frozen state machine can process transitions concurrently without any registration contention.
+func (sm *StateMachine) Freeze() {
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+
+	freezeHandlers(sm.checkHandlers, sm.CheckHandlers, handlerFuncWithContext)
+	freezeHandlers(sm.onErrorHandlers, sm.OnErrorHandlers, handlerFuncWithContext)
+	freezeHandlers(sm.onSuccessHandlers, sm.OnSuccessHandlers, handlerFuncWithContext)
+	freezeHandlers(sm.adapterHandlers, sm.AdapterHandlers, adapterFunctionWithContext)
+	freezeHandlers(sm.filterHandlers, sm.FilterHandlers, filterFunctionWithContext)
+	freezeHandlers(sm.compensateHandlers, sm.CompensateHandlers, handlerFuncWithContext)
+	sm.frozen = true
+}
+
+// freezeHandlers adds the handlers of the exported map to the ones registered with a context, which take precedence
+func freezeHandlers[C any, F any](contextHandlers map[string]C, handlers map[string]F, withContext func(F) C) {
+	for name, handler := range handlers {
+		if _, ok := contextHandlers[name]; !ok {
+			contextHandlers[name] = withContext(handler)
+		}
+	}
+}
+
+func (sm *StateMachine) IsFrozen() bool {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	return sm.frozen
+}
+
+// Untyped returns the state machine itself, see TypedStateMachine
+func (sm *StateMachine) Untyped() IStateMachine {
+	return sm
+}
+
 func (sm *StateMachine) AddCheckFunction(name string, handler HandlerFunc) {
-	sm.CheckHandlers[name] = handler
+	sm.register(func() {
+		sm.CheckHandlers[name] = handler
+		delete(sm.checkHandlers, name)
+	})
 }
 
 func (sm *StateMachine) AddOnErrorFunction(name string, handler HandlerFunc) {
-	sm.OnErrorHandlers[name] = handler
+	sm.register(func() {
+		sm.OnErrorHandlers[name] = handler
+		delete(sm.onErrorHandlers, name)
+	})
 }
 
 func (sm *StateMachine) AddOnSuccessFunction(name string, handler HandlerFunc) {
-	sm.OnSuccessHandlers[name] = handler
+	sm.register(func() {
+		sm.OnSuccessHandlers[name] = handler
+		delete(sm.onSuccessHandlers, name)
+	})
 }
 
 func (sm *StateMachine) AddExecuteFunction(handler HandlerExecFunction) {
-	sm.execute = handler
+	sm.AddExecuteFunctionContext(func(_ context.Context, nextState string, obj any) error {
+		return handler(nextState, obj)
+	})
 }
 
 func (sm *StateMachine) AddStateMachineToTrigger(name string, stateMachine IStateMachine) IStateMachine {
-	sm.stateMachinesToTriggerMap[name] = stateMachine
+	sm.register(func() {
+		sm.stateMachinesToTriggerMap[name] = stateMachine
+	})
 	return sm
 }
 
 func (sm *StateMachine) AddAdapterFunction(name string, handler HandlerAdapterFunction) {
-	sm.AdapterHandlers[name] = handler
+	sm.register(func() {
+		sm.AdapterHandlers[name] = handler
+		delete(sm.adapterHandlers, name)
+	})
 }
 
 func (sm *StateMachine) AddFilterFunction(name string, handler HandlerFilterFunction) {
-	sm.FilterHandlers[name] = handler
+	sm.register(func() {
+		sm.FilterHandlers[name] = handler
+		delete(sm.filterHandlers, name)
+	})
 }
 
 func (sm *StateMachine) AddCurrentStateFunction(handler CurrentStateFunc) {
-	sm.currentState = handler
+	sm.AddCurrentStateFunctionContext(func(_ context.Context, obj any) (string, error) {
+		return handler(obj)
+	})
+}
+
+func (sm *StateMachine) AddCheckFunctionContext(name string, handler HandlerFuncContext) {
+	sm.register(func() {
+		sm.checkHandlers[name] = handler
+		delete(sm.CheckHandlers, name)
+	})
+}
+
+func (sm *StateMachine) AddOnErrorFunctionContext(name string, handler HandlerFuncContext) {
+	sm.register(func() {
+		sm.onErrorHandlers[name] = handler
+		delete(sm.OnErrorHandlers, name)
+	})
+}
+
+func (sm *StateMachine) AddOnSuccessFunctionContext(name string, handler HandlerFuncContext) {
+	sm.register(func() {
+		sm.onSuccessHandlers[name] = handler
+		delete(sm.OnSuccessHandlers, name)
+	})
+}
+
+func (sm *StateMachine) AddExecuteFunctionContext(handler HandlerExecFunctionContext) {
+	sm.AddVersionedExecuteFunctionContext(func(ctx context.Context, _, nextState string, _ int64, obj any) error {
+		return handler(ctx, nextState, obj)
+	})
+}
+
+func (sm *StateMachine) AddVersionedExecuteFunction(handler HandlerVersionedExecFunction) {
+	sm.AddVersionedExecuteFunctionContext(func(_ context.Context, from, nextState string, version int64, obj any) error {
+		return handler(from, nextState, version, obj)
+	})
+}
+
+// AddVersionedExecuteFunctionContext sets an execute function that receives the state and the version read
+// by the transition, to write the next state only when the object is still in it (e.g. UPDATE ... WHERE state = from).
+// It returns an ErrConcurrentModification when the object was modified concurrently, its empty fields are filled.
+// The versions are the ones of the versioned current state function, incremented by one on each write.
+func (sm *StateMachine) AddVersionedExecuteFunctionContext(handler HandlerVersionedExecFunctionContext) {
+	sm.register(func() {
+		sm.execute = handler
+	})
+}
+
+func (sm *StateMachine) AddAdapterFunctionContext(name string, handler HandlerAdapterFunctionContext) {
+	sm.register(func() {
+		sm.adapterHandlers[name] = handler
+		delete(sm.AdapterHandlers, name)
+	})
+}
+
+func (sm *StateMachine) AddFilterFunctionContext(name string, handler HandlerFilterFunctionContext) {
+	sm.register(func() {
+		sm.filterHandlers[name] = handler
+		delete(sm.FilterHandlers, name)
+	})
+}
+
+func (sm *StateMachine) AddCurrentStateFunctionContext(handler CurrentStateFuncContext) {
+	sm.AddVersionedCurrentStateFunctionContext(func(ctx context.Context, obj any) (string, int64, error) {
+		state, err := handler(ctx, obj)
+		return state, 0, err
+	})
+}
+
+func (sm *StateMachine) AddVersionedCurrentStateFunction(handler VersionedCurrentStateFunc) {
+	sm.AddVersionedCurrentStateFunctionContext(func(_ context.Context, obj any) (string, int64, error) {
+		return handler(obj)
+	})
+}
+
+// AddVersionedCurrentStateFunctionContext sets a current state function that also returns the version of the state,
+// given to the versioned execute function
+func (sm *StateMachine) AddVersionedCurrentStateFunctionContext(handler VersionedCurrentStateFuncContext) {
+	sm.register(func() {
+		sm.currentState = handler
+	})
+}
+
+// register applies a registration under the write lock, panicking with an ErrFrozen when the machine is frozen
+func (sm *StateMachine) register(register func()) {
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+
+	if sm.frozen {
+		panic(&ErrFrozen{Machine: sm.Name})
+	}
+
+	sm.validated = false
+	register()
 }
 
 func (sm *StateMachine) ProcessTransition(nextState string, obj any) (success bool, err error) {
+	return sm.ProcessTransitionContext(context.Background(), nextState, obj)
+}
+
+// ProcessTransitionContext processes the transition of the object to the next state.
+//
+// A failed transition returns false and the error of the failure, even when its on_error handlers succeed.
+// This is a breaking change: the transitions used to return the result of the on_error handlers, so a failure
+// handled by them reported a success. Check the error (e.g. errors.Is with ErrCheckRejected) instead.
+//
+// With a conflict retry,
+// a transition failing with an ErrConcurrentModification of its own write is processed again, from the current
+// state read again and through its checks, without running the on_error handlers of the conflicting attempts.
+func (sm *StateMachine) ProcessTransitionContext(ctx context.Context, nextState string, obj any) (success bool, err error) {
+	return sm.processTransitionWithRetry(ctx, transitionRequest{nextState: nextState}, obj)
+}
+
+// processTransitionWithRetry processes the transition of the request again while it conflicts and conflict retries remain
+func (sm *StateMachine) processTransitionWithRetry(ctx context.Context, request transitionRequest, obj any) (success bool, err error) {
+	retries := sm.getConflictRetries()
+	for attempt := 0; ; attempt++ {
+		run := sm.newTransitionRun(ctx, "", request.nextState, obj)
+		run.event, run.within = request.event, request.within
+		run.retryConflict = attempt < retries
+		success, err = sm.processTransition(ctx, run, obj)
+		if !run.retryConflict || !run.conflicted() {
+			return success, err
+		}
+	}
+}
+
+// processTransition runs a transition attempt from the current state of the object,
+// the next state of an event is resolved from the current state
+func (sm *StateMachine) processTransition(ctx context.Context, run *transitionRun, obj any) (success bool, err error) {
+	nextState := run.to
+	defer func() {
+		sm.audit(ctx, run, success, err)
+	}()
+
+	if err = ctx.Err(); err != nil {
+		return false, &ErrTransitionCanceled{Machine: sm.GetName(), NextState: nextState, Err: err}
+	}
+
+	if err = sm.ensureValidated(); err != nil {
+		return false, err
+	}
+
 	// Get handlers
-	currentState, err := sm.currentState(obj)
+	currentState, err := sm.readRunState(ctx, run, obj)
 	if err != nil {
+		if cancelErr := sm.canceled(ctx, currentState, nextState); cancelErr != nil {
+			return false, cancelErr
+		}
+		run.fail(transitionStageCurrentState, "", err)
 		return false, err
 	}
 
-	handlers, exitTransition := sm.MapStates[currentState][nextState]
+	if run.within != "" && !sm.IsIn(currentState, run.within) {
+		// the object left the state of the scheduled transition
+		run.notAllowed = true
+		return false, nil
+	}
+
+	if sm.IsFinalState(currentState) {
+		run.notAllowed = true
+		return false, &ErrFinalState{Machine: sm.GetName(), State: currentState, NextState: nextState, Event: run.event}
+	}
+
+	if run.event != "" {
+		var ok bool
+		if nextState, ok = sm.getEventTarget(currentState, run.event); !ok {
+			run.notAllowed = true
+			return false, &ErrEventNotAllowed{Machine: sm.GetName(), State: currentState, Event: run.event}
+		}
+		run.to = nextState
+	}
+
+	handlers, exitTransition := sm.getHandlers(currentState, nextState)
 	if !exitTransition {
-		return false, errors.ErrorInStateMachineTransition().Formats(currentState, nextState, sm.Name)
+		run.notAllowed = true
+		return false, &ErrTransitionNotAllowed{Machine: sm.GetName(), State: currentState, NextState: nextState}
+	}
+	run.to = sm.resolveState(nextState)
+	if run.fromVector != nil {
+		run.toVector = run.fromVector.with(run.region, run.to)
 	}
 
-	success, err = sm.runCheckFunction(handlers.Check, obj)
+	return sm.runTransition(ctx, run, handlers, obj)
+}
+
+func (sm *StateMachine) ProcessInitialTransition(obj any) (success bool, err error) {
+	return sm.ProcessInitialTransitionContext(context.Background(), obj)
+}
+
+// ProcessInitialTransitionContext creates the first state of an entity, running the create handlers
+// of the initial state through the check, execute and on_success pipeline
+func (sm *StateMachine) ProcessInitialTransitionContext(ctx context.Context, obj any) (success bool, err error) {
+	sm.mux.RLock()
+	name, initialState, handlers := sm.Name, sm.initialState, sm.initialHandlers
+	sm.mux.RUnlock()
+
+	if initialState == "" {
+		return false, fmt.Errorf("state machine [%s] does not declare an initial state", name)
+	}
+
+	run := sm.newTransitionRun(ctx, "", sm.resolveState(initialState), obj)
+	if sm.hasRegions() {
+		run.fromVector, run.toVector = StateVector{}, sm.initialVector(run.to)
+	}
+	defer func() {
+		sm.audit(ctx, run, success, err)
+	}()
+
+	if err = ctx.Err(); err != nil {
+		return false, &ErrTransitionCanceled{Machine: name, NextState: initialState, Err: err}
+	}
+
+	if err = sm.ensureValidated(); err != nil {
+		return false, err
+	}
+
+	return sm.runTransition(ctx, run, handlers, obj)
+}
+
+// runTransition runs the check, execute and on_success pipeline of a transition with its lifecycle hooks,
+// running the on_error handlers when any of them fails:
+// check, before_transition, on_exit, execute, on_enter, on_success, after_transition.
+// With a TxManager, the stages from execute on run in a transaction committed when all of them succeed.
+func (sm *StateMachine) runTransition(ctx context.Context, run *transitionRun, handlers Handlers, obj any) (success bool, err error) {
+	currentState, nextState := run.from, run.to
+	hooks := sm.getLifecycleHooks(currentState, nextState)
+	if currentState == "" && run.toVector != nil {
+		hooks.onEnter = append(hooks.onEnter, sm.getRegionEntryHooks(run.toVector)...)
+	}
+
+	success, err = sm.runJoin(run, handlers.Join)
+	if err == nil {
+		success, err = sm.runGuard(run, handlers.Guard, obj)
+	}
+	if err == nil {
+		success, err = sm.runCheckFunction(ctx, run, handlers.Check, obj)
+	}
+	if cancelErr := sm.canceled(ctx, currentState, nextState); cancelErr != nil {
+		return false, cancelErr
+	}
 	if err != nil {
-		if success, err = sm.runOnErrorFunction(handlers.OnError, obj); err != nil {
-			return success, err
-		}
-		return success, err
+		return sm.runOnError(ctx, run, handlers.OnError, obj, err)
 	}
 
 	if !success {
 		return false, nil
 	}
 
-	err = sm.execute(nextState, obj)
+	for _, stage := range []lifecycleStage{
+		{name: transitionStageBeforeTransition, handlers: hooks.beforeTransition},
+		{name: transitionStageOnExit, handlers: hooks.onExit},
+	} {
+		if success, err = sm.runLifecycleStage(ctx, run, stage, obj); err != nil || !success {
+			return sm.runStageFailure(ctx, run, handlers, obj, success, err)
+		}
+	}
+
+	txCtx, tx, err := sm.beginTx(ctx, run)
 	if err != nil {
-		if success, err = sm.runOnErrorFunction(handlers.OnError, obj); err != nil {
+		run.fail(transitionStageBegin, "", err)
+		return sm.runOnError(ctx, run, handlers.OnError, obj, err)
+	}
+
+	success, err = sm.runUnitOfWork(txCtx, run, handlers, hooks, obj)
+	if err == nil && success {
+		if err = tx.commit(); err != nil {
+			run.fail(transitionStageCommit, "", err)
+		}
+	} else if rollbackErr := tx.rollback(); rollbackErr != nil {
+		err = errors.Join(err, rollbackErr)
+	}
+
+	if err == nil && success {
+		sm.handOverCompensations(ctx, run, obj)
+	} else {
+		err = sm.compensate(ctx, run, err)
+	}
+
+	return sm.runStageFailure(ctx, run, handlers, obj, success, err)
+}
+
+// runUnitOfWork runs the stages from execute to after_transition, schedules the timers of the entered states
+// and processes the joins of the regions, without the on_error handlers
+func (sm *StateMachine) runUnitOfWork(ctx context.Context, run *transitionRun, handlers Handlers, hooks lifecycleHooks, obj any) (success bool, err error) {
+	err = sm.writeState(ctx, run, handlers.Retry, obj)
+	if cancelErr := sm.canceled(ctx, run.from, run.to); cancelErr != nil {
+		return false, cancelErr
+	}
+	if err != nil {
+		run.fail(transitionStageExecute, "", err)
+		return false, err
+	}
+
+	for _, stage := range []lifecycleStage{
+		{name: transitionStageOnEnter, handlers: hooks.onEnter},
+		{name: transitionStageOnSuccess, handlers: handlers.OnSuccess},
+		{name: transitionStageAfterTransition, handlers: hooks.afterTransition},
+	} {
+		if success, err = sm.runLifecycleStage(ctx, run, stage, obj); err != nil || !success {
 			return success, err
 		}
+	}
+
+	if success, err = sm.scheduleTimers(ctx, run, obj); err != nil || !success {
 		return success, err
 	}
 
-	success, err = sm.runOnSuccessFunction(handlers.OnSuccess, obj)
-	if err != nil {
-		return sm.runOnErrorFunction(handlers.OnError, obj)
+	return sm.runJoins(ctx, run, obj)
+}
+
+// runLifecycleStage runs the on_success like handlers of a stage
+func (sm *StateMachine) runLifecycleStage(ctx context.Context, run *transitionRun, stage lifecycleStage, obj any) (success bool, err error) {
+	success, err = sm.runOnSuccessFunction(ctx, run, stage.name, stage.handlers, obj)
+	if cancelErr := sm.canceled(ctx, run.from, run.to); cancelErr != nil {
+		return false, cancelErr
+	}
+
+	return success, err
+}
+
+// runStageFailure runs the on_error handlers when a stage failed with an error,
+// a canceled transition, a conflict to retry or a stage without success returns as is
+func (sm *StateMachine) runStageFailure(ctx context.Context, run *transitionRun, handlers Handlers, obj any, success bool, err error) (bool, error) {
+	var canceled *ErrTransitionCanceled
+	if err == nil || errors.As(err, &canceled) || (run.retryConflict && run.conflicted()) {
+		return success && err == nil, err
+	}
+
+	return sm.runOnError(ctx, run, handlers.OnError, obj, err)
+}
+
+// runOnError runs the on_error handlers after a failure, the transition always fails with the error
+// of the failure, joined with the error of the on_error handlers when they fail too.
+// The result of the on_error handlers is no longer the result of the transition, see ProcessTransitionContext.
+func (sm *StateMachine) runOnError(ctx context.Context, run *transitionRun, handlers []OnErrorStruct, obj any, err error) (bool, error) {
+	if _, onErrorErr := sm.runOnErrorFunction(ctx, run, handlers, obj); onErrorErr != nil {
+		return false, errors.Join(err, onErrorErr)
+	}
+
+	return false, err
+}
+
+// canceled returns a typed cancellation error when the context is done
+func (sm *StateMachine) canceled(ctx context.Context, currentState, nextState string) error {
+	if err := ctx.Err(); err != nil {
+		return &ErrTransitionCanceled{
+			Machine:   sm.GetName(),
+			State:     currentState,
+			NextState: nextState,
+			Err:       err,
+		}
 	}
 
-	return success, nil
+	return nil
+}
+
+// ensureValidated validates the state machine once when the validation on transition is enabled
+func (sm *StateMachine) ensureValidated() error {
+	sm.mux.RLock()
+	done := !sm.validateOnTransition || sm.validated
+	sm.mux.RUnlock()
+	if done {
+		return nil
+	}
+
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+	if sm.validated {
+		return nil
+	}
+
+	if err := sm.validate(); err != nil {
+		return err
+	}
+	sm.validated = true
+
+	return nil
+}
+
+// getHandlers returns the handlers of the transition of the current state, or the one inherited from its nearest ancestor
+func (sm *StateMachine) getHandlers(currentState, nextState string) (Handlers, bool) {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	for _, state := range sm.lineage(currentState) {
+		if handlers, ok := sm.MapStates[state][nextState]; ok {
+			return handlers, true
+		}
+	}
+	return Handlers{}, false
 }
 
-func (sm *StateMachine) getCheckFunction(name string) HandlerFunc {
-	// it's an internal function
-	return sm.CheckHandlers[name]
+// getLifecycleHooks returns the hooks of a transition, the on_exit hooks of the exited states from the current one
+// outwards and the on_enter hooks of the entered states inwards to the next one
+func (sm *StateMachine) getLifecycleHooks(currentState, nextState string) lifecycleHooks {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+
+	hooks := lifecycleHooks{
+		beforeTransition: sm.BeforeTransition,
+		afterTransition:  sm.AfterTransition,
+	}
+
+	for _, state := range sm.exitedStates(currentState, nextState) {
+		hooks.onExit = append(hooks.onExit, sm.OnExit[state]...)
+	}
+
+	entered := sm.exitedStates(nextState, currentState)
+	for i := len(entered) - 1; i >= 0; i-- {
+		hooks.onEnter = append(hooks.onEnter, sm.OnEnter[entered[i]]...)
+	}
+
+	return hooks
 }
-func (sm *StateMachine) getOnErrorFunction(name string) HandlerFunc {
-	return sm.OnErrorHandlers[name]
+
+func (sm *StateMachine) getCurrentStateFunction() VersionedCurrentStateFuncContext {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	return sm.currentState
 }
 
-func (sm *StateMachine) getOnSuccessFunction(name string) HandlerFunc {
-	return sm.OnSuccessHandlers[name]
+func (sm *StateMachine) getExecuteFunction() HandlerVersionedExecFunctionContext {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	return sm.execute
 }
 
-func (sm *StateMachine) getAdapterFunction(name string) HandlerAdapterFunction {
-	return sm.AdapterHandlers[name]
+func (sm *StateMachine) getCheckFunction(name string) HandlerFuncContext {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	return sm.checkFunction(name)
 }
 
-func (sm *StateMachine) getFilterFunction(name string) HandlerFilterFunction {
-	return sm.FilterHandlers[name]
+func (sm *StateMachine) getOnErrorFunction(name string) HandlerFuncContext {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	return sm.onErrorFunction(name)
+}
+
+func (sm *StateMachine) getOnSuccessFunction(name string) HandlerFuncContext {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	return sm.onSuccessFunction(name)
+}
+
+func (sm *StateMachine) getAdapterFunction(name string) HandlerAdapterFunctionContext {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	return sm.adapterFunction(name)
+}
+
+func (sm *StateMachine) getFilterFunction(name string) HandlerFilterFunctionContext {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	return sm.filterFunction(name)
+}
+
+// checkFunction returns the check registered with or without a context, the caller must hold the lock
+func (sm *StateMachine) checkFunction(name string) HandlerFuncContext {
+	return lookupHandler(sm.frozen, sm.checkHandlers, sm.CheckHandlers, name, handlerFuncWithContext)
+}
+
+// onErrorFunction returns the on_error handler registered with or without a context, the caller must hold the lock
+func (sm *StateMachine) onErrorFunction(name string) HandlerFuncContext {
+	return lookupHandler(sm.frozen, sm.onErrorHandlers, sm.OnErrorHandlers, name, handlerFuncWithContext)
+}
+
+// onSuccessFunction returns the on_success handler registered with or without a context, the caller must hold the lock
+func (sm *StateMachine) onSuccessFunction(name string) HandlerFuncContext {
+	return lookupHandler(sm.frozen, sm.onSuccessHandlers, sm.OnSuccessHandlers, name, handlerFuncWithContext)
+}
+
+// adapterFunction returns the adapter registered with or without a context, the caller must hold the lock
+func (sm *StateMachine) adapterFunction(name string) HandlerAdapterFunctionContext {
+	return lookupHandler(sm.frozen, sm.adapterHandlers, sm.AdapterHandlers, name, adapterFunctionWithContext)
+}
+
+// filterFunction returns the filter registered with or without a context, the caller must hold the lock
+func (sm *StateMachine) filterFunction(name string) HandlerFilterFunctionContext {
+	return lookupHandler(sm.frozen, sm.filterHandlers, sm.FilterHandlers, name, filterFunctionWithContext)
+}
+
+// lookupHandler returns the handler registered with a context, or the one of the exported map without a context
+// (e.g. set directly in CheckHandlers), nil when there is none. The exported map of a frozen state machine is not
+// read, its handlers were added to the ones registered with a context by Freeze.
+func lookupHandler[C any, F any](frozen bool, contextHandlers map[string]C, handlers map[string]F, name string, withContext func(F) C) C {
+	if handler, ok := contextHandlers[name]; ok {
+		return handler
+	}
+
+	if handler, ok := handlers[name]; ok && !frozen {
+		return withContext(handler)
+	}
+
+	var none C
+	return none
 }
 
 func (sm *StateMachine) getStateMachineToTrigger(name string) IStateMachine {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
 	return sm.stateMachinesToTriggerMap[name]
 }
 
-func (sm *StateMachine) runCheckFunction(handlers []CheckStruct, obj any) (success bool, err error) {
-	success = true
+// runGuard evaluates the guard of the transition, a guard that does not pass rejects the transition
+func (sm *StateMachine) runGuard(run *transitionRun, guard *Guard, obj any) (bool, error) {
+	if guard == nil {
+		return true, nil
+	}
+
+	success, err := guard.Eval(obj)
+	if err == nil && !success {
+		err = &ErrGuardRejected{Machine: run.machine, State: run.from, NextState: run.to, Guard: guard.String()}
+	}
+	if err != nil {
+		run.fail(transitionStageCheck, "guard", err)
+		return false, err
+	}
+
+	return true, nil
+}
+
+// runCheckFunction runs the checks in order, every check must pass
+func (sm *StateMachine) runCheckFunction(ctx context.Context, run *transitionRun, handlers []CheckStruct, obj any) (success bool, err error) {
 	for _, handler := range handlers {
-		handlerFunc := sm.getCheckFunction(handler.Func)
+		success, failed, err := sm.runCheck(ctx, run, handler, obj)
+		if err != nil {
+			run.fail(transitionStageCheck, checkName(failed), err)
+			return false, err
+		}
 
-		success, err = handlerFunc(obj, handler.FuncArg...)
-		if err != nil && !handler.IgnoreError {
+		if !success {
+			err = &ErrCheckRejected{
+				Machine:   run.machine,
+				State:     run.from,
+				NextState: run.to,
+				Check:     checkName(failed),
+				Args:      failed.FuncArg,
+			}
+			run.fail(transitionStageCheck, checkName(failed), err)
 			return false, err
 		}
+	}
 
-		if !success && !handler.IgnoreNoSuccess {
-			return false, errors.ErrorInStateMachineTransition()
+	return true, nil
+}
+
+// runCheck runs a check or a group of checks with short circuit,
+// returning the check that caused the rejection or the error
+func (sm *StateMachine) runCheck(ctx context.Context, run *transitionRun, handler CheckStruct, obj any) (success bool, failed CheckStruct, err error) {
+	if err = ctx.Err(); err != nil {
+		return false, handler, err
+	}
+
+	switch {
+	case handler.Not != nil:
+		success, failed, err = sm.runCheck(ctx, run, *handler.Not, obj)
+		if err == nil {
+			success, failed = !success, handler
+		}
+	case len(handler.Any) > 0:
+		// when every check of the group is rejected, the failure names the rejected check of each one
+		var rejected []CheckStruct
+		for _, item := range handler.Any {
+			itemSuccess, itemFailed, itemErr := sm.runCheck(ctx, run, item, obj)
+			if itemErr != nil {
+				failed, err = itemFailed, itemErr
+				break
+			}
+			if itemSuccess {
+				success = true
+				break
+			}
+			rejected = append(rejected, itemFailed)
+		}
+		if err == nil && !success {
+			failed = CheckStruct{Any: rejected}
 		}
+	case len(handler.All) > 0:
+		success = true
+		for _, item := range handler.All {
+			if success, failed, err = sm.runCheck(ctx, run, item, obj); err != nil || !success {
+				break
+			}
+		}
+	default:
+		failed = handler
+		handlerFunc := sm.getCheckFunction(handler.Func)
+		if handlerFunc == nil {
+			return false, failed, &ErrHandlerNotRegistered{Machine: run.machine, Kind: ValidationKindCheck, Name: handler.Func}
+		}
+		success, err = handlerFunc(ctx, obj, handler.FuncArg...)
+	}
+
+	var notRegistered *ErrHandlerNotRegistered
+	if err != nil && handler.IgnoreError && ctx.Err() == nil && !errors.As(err, &notRegistered) {
+		err = nil
+	}
+
+	if err == nil && !success && handler.IgnoreNoSuccess {
+		success = true
+	}
+
+	return success, failed, err
+}
+
+// checkName names a check function, or formats a group of checks
+func checkName(check CheckStruct) string {
+	if check.Func != "" {
+		return check.Func
 	}
 
-	return success, nil
+	return formatCheck(check)
 }
 
-func (sm *StateMachine) runOnErrorFunction(handlers []OnErrorStruct, obj any) (bool, error) {
+// childMachineFailed wraps the error of a triggered state machine, extending the path of nested failures
+func childMachineFailed(machine, child, nextState string, err error) error {
+	var childErr *ErrChildMachineFailed
+	if errors.As(err, &childErr) {
+		return &ErrChildMachineFailed{
+			Machine:   childErr.Machine,
+			Path:      append([]string{machine}, childErr.Path...),
+			NextState: childErr.NextState,
+			Err:       childErr.Err,
+		}
+	}
+
+	return &ErrChildMachineFailed{
+		Machine:   child,
+		Path:      []string{machine, child},
+		NextState: nextState,
+		Err:       err,
+	}
+}
+
+func (sm *StateMachine) runOnErrorFunction(ctx context.Context, run *transitionRun, handlers []OnErrorStruct, obj any) (bool, error) {
 	for _, handler := range handlers {
 		handlerFunc := sm.getOnErrorFunction(handler.Func)
-		success, err := handlerFunc(obj)
+		if handlerFunc == nil {
+			err := &ErrHandlerNotRegistered{Machine: run.machine, Kind: ValidationKindOnError, Name: handler.Func}
+			run.fail(transitionStageOnError, handler.Func, err)
+			return false, err
+		}
+
+		success, err := handlerFunc(ctx, obj)
 		if err != nil && !handler.IgnoreError {
+			run.fail(transitionStageOnError, handler.Func, err)
 			return false, err
 		}
 
 		if !success && !handler.IgnoreNoSuccess {
+			run.fail(transitionStageOnError, handler.Func, nil)
 			return false, nil
 		}
 	}
@@ -220,51 +1150,108 @@ func (sm *StateMachine) runOnErrorFunction(handlers []OnErrorStruct, obj any) (b
 	return true, nil
 }
 
-func (sm *StateMachine) runOnSuccessFunction(handlers []OnSuccessStruct, obj any) (bool, error) {
+func (sm *StateMachine) runOnSuccessFunction(ctx context.Context, run *transitionRun, stage string, handlers []OnSuccessStruct, obj any) (bool, error) {
 	for _, handler := range handlers {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+
 		objs := []any{obj}
 
-		adapter := sm.getAdapterFunction(handler.Adapter)
-		if adapter != nil {
-			newObjs, err := adapter(obj)
+		if handler.Adapter != "" {
+			adapter := sm.getAdapterFunction(handler.Adapter)
+			if adapter == nil {
+				err := &ErrHandlerNotRegistered{Machine: run.machine, Kind: ValidationKindAdapter, Name: handler.Adapter}
+				run.fail(stage, handler.Adapter, err)
+				return false, err
+			}
+
+			newObjs, err := adapter(ctx, obj)
 			if err != nil {
+				run.fail(stage, handler.Adapter, err)
 				return false, err
 			}
 			objs = newObjs
 		}
 
-		filter := sm.getFilterFunction(handler.Filter)
-		if filter != nil {
-			newObjs, err := filter(objs)
+		if handler.Filter != "" {
+			filter := sm.getFilterFunction(handler.Filter)
+			if filter == nil {
+				err := &ErrHandlerNotRegistered{Machine: run.machine, Kind: ValidationKindFilter, Name: handler.Filter}
+				run.fail(stage, handler.Filter, err)
+				return false, err
+			}
+
+			newObjs, err := filter(ctx, objs)
 			if err != nil {
+				run.fail(stage, handler.Filter, err)
 				return false, err
 			}
 			objs = newObjs
 		}
 
 		for _, obj := range objs {
+			if err := ctx.Err(); err != nil {
+				return false, err
+			}
+
 			if handler.IsStateMachine {
 				smTrigger := sm.getStateMachineToTrigger(handler.Func)
-				if smTrigger != nil {
-					success, err := smTrigger.ProcessTransition(handler.FuncArg[1], obj)
-					if err != nil && !handler.IgnoreError {
-						return false, err
-					}
-
-					if !success && !handler.IgnoreNoSuccess {
-						return false, nil
-					}
+				if smTrigger == nil || len(handler.FuncArg) < 2 {
+					err := &ErrHandlerNotRegistered{Machine: run.machine, Kind: ValidationKindStateMachine, Name: handler.Func}
+					run.fail(stage, handler.Func, err)
+					return false, err
+				}
+
+				var collector *compensationCollector
+				if handler.Compensate == CompensateRevert {
+					collector = &compensationCollector{}
+				}
+
+				success, err := triggerTransition(run.childContext(ctx, collector), smTrigger, handler.FuncArg[1], obj)
+				if err != nil && !handler.IgnoreError {
+					err = childMachineFailed(run.machine, smTrigger.GetName(), handler.FuncArg[1], err)
+					run.fail(stage, handler.Func, err)
+					return false, err
+				}
+
+				if !success && !handler.IgnoreNoSuccess {
+					run.fail(stage, handler.Func, nil)
+					return false, nil
+				}
+
+				if err == nil && success && collector != nil {
+					run.compensations = append(run.compensations, collector.compensations...)
 				}
 			} else {
 				handlerFunc := sm.getOnSuccessFunction(handler.Func)
-				success, err := handlerFunc(obj, handler.FuncArg...)
+				if handlerFunc == nil {
+					err := &ErrHandlerNotRegistered{Machine: run.machine, Kind: stage, Name: handler.Func}
+					run.fail(stage, handler.Func, err)
+					return false, err
+				}
+
+				retry := handler.Retry
+				if stage == transitionStageOnSuccess {
+					retry = sm.getRetryPolicy(retry)
+				}
+
+				success, err := sm.retry(ctx, retry, func() (bool, error) {
+					return handlerFunc(ctx, obj, handler.FuncArg...)
+				})
 				if err != nil && !handler.IgnoreError {
+					run.fail(stage, handler.Func, err)
 					return false, err
 				}
 
 				if !success && !handler.IgnoreNoSuccess {
+					run.fail(stage, handler.Func, nil)
 					return false, nil
 				}
+
+				if err == nil && success {
+					sm.addCompensation(run, handler, obj)
+				}
 			}
 		}
 	}
@@ -272,6 +1259,48 @@ func (sm *StateMachine) runOnSuccessFunction(handlers []OnSuccessStruct, obj any
 	return true, nil
 }
 
+// triggerTransition processes the transition of a triggered state machine, with the context of the triggering
+// transition when the state machine processes transitions with a context
+func triggerTransition(ctx context.Context, stateMachine IStateMachine, nextState string, obj any) (bool, error) {
+	if contextStateMachine, ok := stateMachine.(interface {
+		ProcessTransitionContext(ctx context.Context, nextState string, obj any) (bool, error)
+	}); ok {
+		return contextStateMachine.ProcessTransitionContext(ctx, nextState, obj)
+	}
+
+	return stateMachine.ProcessTransition(nextState, obj)
+}
+
+// handlerFuncWithContext adapts a handler without context to the context aware signature
+func handlerFuncWithContext(handler HandlerFunc) HandlerFuncContext {
+	if handler == nil {
+		return nil
+	}
+	return func(_ context.Context, arg any, optArg ...string) (bool, error) {
+		return handler(arg, optArg...)
+	}
+}
+
+// adapterFunctionWithContext adapts an adapter without context to the context aware signature
+func adapterFunctionWithContext(handler HandlerAdapterFunction) HandlerAdapterFunctionContext {
+	if handler == nil {
+		return nil
+	}
+	return func(_ context.Context, obj any) ([]any, error) {
+		return handler(obj)
+	}
+}
+
+// filterFunctionWithContext adapts a filter without context to the context aware signature
+func filterFunctionWithContext(handler HandlerFilterFunction) HandlerFilterFunctionContext {
+	if handler == nil {
+		return nil
+	}
+	return func(_ context.Context, objs []any) ([]any, error) {
+		return handler(objs)
+	}
+}
+
 func splitFunctionAndArguments(input string) (function string, arguments []string) {
 	pattern := regexp.MustCompile(`^[a-zA-Z0-9_-]+(?:-[a-zA-Z0-9_-]+)?\((?:[a-zA-Z0-9_-]+(?:-[a-zA-Z0-9_]+)?)*(,\s*[a-zA-Z0-9_-]+(?:-[a-zA-Z0-9_]+)*)?\)$`)
 	if !pattern.MatchString(input) {
@@ -0,0 +1,450 @@
+package state_machine
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	reloadOrdersDefinition = `{"name":"orders","states":[
+		{"name":"pending","initial":true,"transitions":[{"name":"paid","event":"pay"}]},
+		{"name":"paying","parent":"pending"},
+		{"name":"paid","final":true,"on_enter":[{"func":"notify"}]}],
+		"regions":[{"name":"shipping","states":[{"name":"preparing","initial":true}]}]}`
+	reloadInvoicesDefinition = `{"name":"invoices","states":[
+		{"name":"draft","initial":true,"transitions":[{"name":"sent"}]},
+		{"name":"sent","final":true}]}`
+)
+
+func TestReload(t *testing.T) {
+	sm := NewStateMachine()
+	for _, definition := range []string{reloadOrdersDefinition, reloadInvoicesDefinition} {
+		if err := sm.LoadFromBytes([]byte(definition), "json"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a failed load keeps the previous definition
+	if err := sm.LoadFromBytes([]byte(`{"name":"broken","states":[
+		{"name":"new","initial":true,"transitions":[{"name":"done","after":"soon"}]}]}`), "json"); err == nil {
+		t.Fatal("LoadFromBytes = nil, want the invalid after rejected")
+	}
+
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{name: "name", got: sm.GetName(), want: "invoices"},
+		{name: "initial state", got: sm.GetInitialState(), want: "draft"},
+		{name: "final states", got: sm.GetFinalStates(), want: []string{"sent"}},
+		{name: "final state of the previous definition", got: sm.IsFinalState("paid"), want: false},
+		{name: "events of the previous definition", got: len(sm.Events("pending")), want: 0},
+		{name: "ancestors of the previous definition", got: len(sm.Ancestors("paying")), want: 0},
+		{name: "regions of the previous definition", got: len(sm.Regions()), want: 0},
+		{name: "states", got: len(sm.GetDefinition().States), want: 2},
+		{name: "on_enter of the previous definition", got: len(sm.OnEnter), want: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if !reflect.DeepEqual(test.got, test.want) {
+				t.Errorf("got %v, want %v", test.got, test.want)
+			}
+		})
+	}
+}
+
+func TestHandlerMaps(t *testing.T) {
+	tests := []struct {
+		name     string
+		register func(sm *StateMachine, calls *[]string)
+		want     []string
+	}{
+		{
+			name: "set in the exported map",
+			register: func(sm *StateMachine, calls *[]string) {
+				sm.CheckHandlers["isPaid"] = func(any, ...string) (bool, error) { *calls = append(*calls, "map"); return true, nil }
+			},
+			want: []string{"map"},
+		},
+		{
+			name: "registered without a context",
+			register: func(sm *StateMachine, calls *[]string) {
+				sm.AddCheckFunction("isPaid", func(any, ...string) (bool, error) { *calls = append(*calls, "func"); return true, nil })
+			},
+			want: []string{"func"},
+		},
+		{
+			name: "registered with a context replaces the one without",
+			register: func(sm *StateMachine, calls *[]string) {
+				sm.AddCheckFunction("isPaid", func(any, ...string) (bool, error) { *calls = append(*calls, "func"); return true, nil })
+				sm.AddCheckFunctionContext("isPaid", func(context.Context, any, ...string) (bool, error) {
+					*calls = append(*calls, "context")
+					return true, nil
+				})
+			},
+			want: []string{"context"},
+		},
+		{
+			name: "registered without a context replaces the one with",
+			register: func(sm *StateMachine, calls *[]string) {
+				sm.AddCheckFunctionContext("isPaid", func(context.Context, any, ...string) (bool, error) {
+					*calls = append(*calls, "context")
+					return true, nil
+				})
+				sm.AddCheckFunction("isPaid", func(any, ...string) (bool, error) { *calls = append(*calls, "func"); return true, nil })
+			},
+			want: []string{"func"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sm := NewStateMachine(WithValidation())
+			if err := sm.LoadFromBytes([]byte(`{"name":"orders","states":[
+				{"name":"pending","initial":true,"transitions":[{"name":"paid","check":[{"func":"isPaid"}]}]},
+				{"name":"paid","final":true}]}`), "json"); err != nil {
+				t.Fatal(err)
+			}
+			sm.AddCurrentStateFunction(func(any) (string, error) { return "pending", nil })
+			sm.AddExecuteFunction(func(string, any) error { return nil })
+
+			var calls []string
+			test.register(sm, &calls)
+			if success, err := sm.ProcessTransition("paid", struct{}{}); err != nil || !success {
+				t.Fatalf("ProcessTransition = %v, %v, want true, nil", success, err)
+			}
+			if !reflect.DeepEqual(calls, test.want) {
+				t.Errorf("calls = %v, want %v", calls, test.want)
+			}
+		})
+	}
+}
+
+func TestProcessInitialTransition(t *testing.T) {
+	tests := []struct {
+		name        string
+		definition  string
+		canCreate   bool
+		wantSuccess bool
+		wantErr     error
+		wantCalls   []string
+	}{
+		{
+			name: "runs the create handlers",
+			definition: `{"name":"orders","states":[
+				{"name":"pending","initial":true,"create":{"check":[{"func":"canCreate"}],"on_success":[{"func":"notify"}]}}]}`,
+			canCreate:   true,
+			wantSuccess: true,
+			wantCalls:   []string{"canCreate", "execute pending", "notify"},
+		},
+		{
+			name: "rejected by a create check",
+			definition: `{"name":"orders","states":[
+				{"name":"pending","initial":true,"create":{"check":[{"func":"canCreate"}],"on_success":[{"func":"notify"}]}}]}`,
+			wantErr:   &ErrCheckRejected{},
+			wantCalls: []string{"canCreate"},
+		},
+		{
+			name: "initial state without create handlers",
+			definition: `{"name":"orders","states":[
+				{"name":"pending","initial":true}]}`,
+			wantSuccess: true,
+			wantCalls:   []string{"execute pending"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sm := NewStateMachine()
+			if err := sm.LoadFromBytes([]byte(test.definition), "json"); err != nil {
+				t.Fatal(err)
+			}
+
+			var calls []string
+			sm.AddCurrentStateFunction(func(any) (string, error) { return "", nil })
+			sm.AddExecuteFunction(func(nextState string, _ any) error {
+				calls = append(calls, "execute "+nextState)
+				return nil
+			})
+			sm.AddCheckFunction("canCreate", func(any, ...string) (bool, error) {
+				calls = append(calls, "canCreate")
+				return test.canCreate, nil
+			})
+			sm.AddOnSuccessFunction("notify", func(any, ...string) (bool, error) {
+				calls = append(calls, "notify")
+				return true, nil
+			})
+
+			success, err := sm.ProcessInitialTransition(struct{}{})
+			if success != test.wantSuccess || (test.wantErr == nil) != (err == nil) || (test.wantErr != nil && !errors.Is(err, test.wantErr)) {
+				t.Errorf("ProcessInitialTransition = %v, %v, want %v, %T", success, err, test.wantSuccess, test.wantErr)
+			}
+			if !reflect.DeepEqual(calls, test.wantCalls) {
+				t.Errorf("calls = %v, want %v", calls, test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestProcessInitialTransitionWithoutInitialState(t *testing.T) {
+	sm := NewStateMachine()
+	if err := sm.LoadFromBytes([]byte(`{"name":"orders","states":[{"name":"pending"}]}`), "json"); err != nil {
+		t.Fatal(err)
+	}
+
+	if success, err := sm.ProcessInitialTransition(struct{}{}); success || err == nil {
+		t.Errorf("ProcessInitialTransition = %v, %v, want the missing initial state", success, err)
+	}
+}
+
+func TestFinalState(t *testing.T) {
+	sm := NewStateMachine()
+	if err := sm.LoadFromBytes([]byte(`{"name":"orders","states":[
+		{"name":"pending","initial":true,"transitions":[{"name":"paid","event":"pay"}]},
+		{"name":"paid","final":true,"transitions":[{"name":"pending","event":"reopen"}]}]}`), "json"); err != nil {
+		t.Fatal(err)
+	}
+	executes := 0
+	sm.AddCurrentStateFunction(func(any) (string, error) { return "paid", nil })
+	sm.AddExecuteFunction(func(string, any) error {
+		executes++
+		return nil
+	})
+
+	tests := []struct {
+		name    string
+		process func() (bool, error)
+	}{
+		{name: "transition", process: func() (bool, error) { return sm.ProcessTransition("pending", struct{}{}) }},
+		{name: "event", process: func() (bool, error) { return sm.Fire("reopen", struct{}{}) }},
+		{name: "dry run", process: func() (bool, error) {
+			evaluation, err := sm.CanTransition("pending", struct{}{})
+			if err == nil {
+				err = evaluation.Reason
+			}
+			return evaluation.Allowed, err
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			success, err := test.process()
+			if success || !errors.Is(err, &ErrFinalState{}) || !errors.Is(err, &ErrTransitionNotAllowed{}) {
+				t.Errorf("process = %v, %v, want an ErrFinalState", success, err)
+			}
+		})
+	}
+
+	if executes != 0 {
+		t.Errorf("execute calls = %d, want 0", executes)
+	}
+	if !sm.IsFinalState("paid") || sm.IsFinalState("pending") || !reflect.DeepEqual(sm.GetFinalStates(), []string{"paid"}) {
+		t.Errorf("final states = %v, want [paid]", sm.GetFinalStates())
+	}
+}
+
+func TestLifecycleHooks(t *testing.T) {
+	errHook := errors.New("hook failed")
+
+	tests := []struct {
+		name      string
+		failing   string
+		wantCalls []string
+	}{
+		{
+			name:      "runs the hooks in order",
+			wantCalls: []string{"lock", "leave", "execute paid", "enter", "notify", "unlock"},
+		},
+		{
+			name:      "before_transition error aborts",
+			failing:   "lock",
+			wantCalls: []string{"lock", "alert"},
+		},
+		{
+			name:      "on_exit error aborts",
+			failing:   "leave",
+			wantCalls: []string{"lock", "leave", "alert"},
+		},
+		{
+			name:      "on_enter error aborts",
+			failing:   "enter",
+			wantCalls: []string{"lock", "leave", "execute paid", "enter", "alert"},
+		},
+		{
+			name:      "after_transition error aborts",
+			failing:   "unlock",
+			wantCalls: []string{"lock", "leave", "execute paid", "enter", "notify", "unlock", "alert"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sm := NewStateMachine()
+			if err := sm.LoadFromBytes([]byte(`{"name":"orders",
+				"before_transition":[{"func":"lock"}],
+				"after_transition":[{"func":"unlock"}],
+				"states":[
+					{"name":"pending","initial":true,"on_exit":[{"func":"leave"}],
+						"transitions":[{"name":"paid","on_success":[{"func":"notify"}],"on_error":[{"func":"alert"}]}]},
+					{"name":"paid","final":true,"on_enter":[{"func":"enter"}]}]}`), "json"); err != nil {
+				t.Fatal(err)
+			}
+
+			var calls []string
+			sm.AddCurrentStateFunction(func(any) (string, error) { return "pending", nil })
+			sm.AddExecuteFunction(func(nextState string, _ any) error {
+				calls = append(calls, "execute "+nextState)
+				return nil
+			})
+			for _, name := range []string{"lock", "leave", "enter", "notify", "unlock"} {
+				name := name
+				sm.AddOnSuccessFunction(name, func(any, ...string) (bool, error) {
+					calls = append(calls, name)
+					if name == test.failing {
+						return false, errHook
+					}
+					return true, nil
+				})
+			}
+			sm.AddOnErrorFunction("alert", func(any, ...string) (bool, error) {
+				calls = append(calls, "alert")
+				return true, nil
+			})
+
+			success, err := sm.ProcessTransition("paid", struct{}{})
+			if wantSuccess := test.failing == ""; success != wantSuccess || (err == nil) != wantSuccess || (err != nil && !errors.Is(err, errHook)) {
+				t.Errorf("ProcessTransition = %v, %v, want success %v", success, err, wantSuccess)
+			}
+			if !reflect.DeepEqual(calls, test.wantCalls) {
+				t.Errorf("calls = %v, want %v", calls, test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestCheckGroups(t *testing.T) {
+	errCheck := errors.New("check failed")
+
+	tests := []struct {
+		name        string
+		check       string
+		wantSuccess bool
+		wantCheck   string
+		wantErr     error
+		wantCalls   []string
+	}{
+		{
+			name:      "all stops at the first rejection",
+			check:     `[{"all":[{"func":"yes"},{"func":"no"},{"func":"yes2"}]}]`,
+			wantCheck: "no",
+			wantCalls: []string{"yes", "no"},
+		},
+		{
+			name:        "any stops at the first success",
+			check:       `[{"any":[{"func":"no"},{"func":"yes"},{"func":"yes2"}]}]`,
+			wantSuccess: true,
+			wantCalls:   []string{"no", "yes"},
+		},
+		{
+			name:      "any names the rejected checks",
+			check:     `[{"any":[{"func":"no"},{"not":{"func":"yes"}}]}]`,
+			wantCheck: "any(no, not(yes))",
+			wantCalls: []string{"no", "yes"},
+		},
+		{
+			name:        "nested groups",
+			check:       `[{"all":[{"func":"yes"},{"any":[{"func":"no"},{"not":{"func":"no"}}]}]}]`,
+			wantSuccess: true,
+			wantCalls:   []string{"yes", "no", "no"},
+		},
+		{
+			name:      "not of a success",
+			check:     `[{"not":{"func":"yes"}}]`,
+			wantCheck: "not(yes)",
+			wantCalls: []string{"yes"},
+		},
+		{
+			name:      "the checks stop at the first rejection",
+			check:     `[{"func":"no"},{"func":"yes"}]`,
+			wantCheck: "no",
+			wantCalls: []string{"no"},
+		},
+		{
+			name:      "an error stops the group",
+			check:     `[{"any":[{"func":"fails"},{"func":"yes"}]}]`,
+			wantErr:   errCheck,
+			wantCalls: []string{"fails"},
+		},
+		{
+			name:        "an ignored error in a group",
+			check:       `[{"any":[{"func":"fails","ignore_error":true},{"func":"yes"}]}]`,
+			wantSuccess: true,
+			wantCalls:   []string{"fails", "yes"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sm := NewStateMachine()
+			if err := sm.LoadFromBytes([]byte(`{"name":"orders","states":[
+				{"name":"pending","initial":true,"transitions":[{"name":"paid","check":`+test.check+`}]},
+				{"name":"paid","final":true}]}`), "json"); err != nil {
+				t.Fatal(err)
+			}
+
+			var calls []string
+			sm.AddCurrentStateFunction(func(any) (string, error) { return "pending", nil })
+			sm.AddExecuteFunction(func(string, any) error { return nil })
+			for name, result := range map[string]bool{"yes": true, "yes2": true, "no": false} {
+				name, result := name, result
+				sm.AddCheckFunction(name, func(any, ...string) (bool, error) {
+					calls = append(calls, name)
+					return result, nil
+				})
+			}
+			sm.AddCheckFunction("fails", func(any, ...string) (bool, error) {
+				calls = append(calls, "fails")
+				return false, errCheck
+			})
+
+			success, err := sm.ProcessTransition("paid", struct{}{})
+			var rejected *ErrCheckRejected
+			switch {
+			case test.wantSuccess:
+				if !success || err != nil {
+					t.Errorf("ProcessTransition = %v, %v, want a success", success, err)
+				}
+			case test.wantErr != nil:
+				if success || !errors.Is(err, test.wantErr) || errors.As(err, &rejected) {
+					t.Errorf("ProcessTransition = %v, %v, want %v", success, err, test.wantErr)
+				}
+			default:
+				if success || !errors.As(err, &rejected) || rejected.Check != test.wantCheck {
+					t.Errorf("ProcessTransition = %v, %v, want the rejection of %s", success, err, test.wantCheck)
+				}
+			}
+			if !reflect.DeepEqual(calls, test.wantCalls) {
+				t.Errorf("calls = %v, want %v", calls, test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestCheckGroupsLoad(t *testing.T) {
+	for _, check := range []string{`{"all":[]}`, `{"any":[]}`, `{}`, `{"func":"yes","all":[{"func":"no"}]}`, `{"not":{"any":[]}}`} {
+		t.Run(check, func(t *testing.T) {
+			sm := NewStateMachine()
+			err := sm.LoadFromBytes([]byte(`{"name":"orders","states":[
+				{"name":"pending","initial":true,"transitions":[{"name":"paid","check":[`+check+`]}]},
+				{"name":"paid","final":true}]}`), "json")
+			if err == nil || !strings.Contains(err.Error(), "exactly one of func, all, any or not") {
+				t.Errorf("LoadFromBytes = %v, want the error of an empty or ambiguous check", err)
+			}
+		})
+	}
+}
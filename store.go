@@ -0,0 +1,201 @@
+package state_machine
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// StateStore reads and writes the states of the objects in place of the current state and execute functions.
+// The writes are optimistic: CompareAndSet only moves an object still in the state and at the version read
+// by Get, so two workers can't both move the same object out of the same state.
+type StateStore interface {
+	// Get returns the state and the version of the object, an empty state and version 0 when it has no state yet
+	Get(ctx context.Context, id string) (state string, version int64, err error)
+	// CompareAndSet sets the state of the object to `to` and increments its version when it is still in the state `from`
+	// at the version `version`, reporting false otherwise. An empty `from` at version 0 creates the state of the object.
+	CompareAndSet(ctx context.Context, id, from, to string, version int64) (bool, error)
+}
+
+// AddStateStore sets the store of the states, objectId identifies the objects in the store.
+// The store replaces the current state function, the execute function is optional and runs after the state
+// is written, e.g. to update the rest of the object in the same transaction.
+func (sm *StateMachine) AddStateStore(store StateStore, objectId func(obj any) string) {
+	sm.register(func() {
+		sm.stateStore = store
+		sm.stateStoreObjectId = objectId
+	})
+}
+
+// WithStateStore sets the store of the states, see AddStateStore
+func WithStateStore(store StateStore, objectId func(obj any) string) Option {
+	return func(sm *StateMachine) {
+		sm.stateStore = store
+		sm.stateStoreObjectId = objectId
+	}
+}
+
+func (sm *StateMachine) getStateStore() (StateStore, func(obj any) string) {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	return sm.stateStore, sm.stateStoreObjectId
+}
+
+// readState reads the current state of the object and its version, from the state store
+// or with the current state function
+func (sm *StateMachine) readState(ctx context.Context, obj any) (string, int64, error) {
+	if store, objectId := sm.getStateStore(); store != nil {
+		return store.Get(ctx, objectId(obj))
+	}
+
+	currentStateFunc := sm.getCurrentStateFunction()
+	if currentStateFunc == nil {
+		return "", 0, &ErrHandlerNotRegistered{Machine: sm.GetName(), Kind: ValidationKindCurrentState}
+	}
+
+	return currentStateFunc(ctx, obj)
+}
+
+// writeState moves the object of the run to its next state, in the state store when there is one,
+// then with the execute function retried with the policy. The retries run in the transaction of the run, they
+// don't begin a new one. With regions, the state store and the execute function receive the encoded state vectors
+// and the execute vector function replaces the execute function.
+func (sm *StateMachine) writeState(ctx context.Context, run *transitionRun, retry *RetryPolicy, obj any) error {
+	from, to := run.storedStates()
+	store, objectId := sm.getStateStore()
+	if store != nil {
+		id := objectId(obj)
+		swapped, err := store.CompareAndSet(ctx, id, from, to, run.version)
+		if err != nil {
+			return &ErrExecuteFailed{Machine: run.machine, State: run.from, NextState: run.to, Err: err}
+		}
+		if !swapped {
+			return &ErrConcurrentModification{Machine: run.machine, ObjectId: id, State: run.from, NextState: run.to, Version: run.version}
+		}
+	}
+
+	var handler func() error
+	if executeVector := sm.getExecuteVectorFunction(); executeVector != nil && run.fromVector != nil {
+		handler = func() error { return executeVector(ctx, run.fromVector, run.toVector, run.version, obj) }
+	} else if execute := sm.getExecuteFunction(); execute != nil {
+		handler = func() error { return execute(ctx, from, to, run.version, obj) }
+	} else if store == nil {
+		return &ErrHandlerNotRegistered{Machine: run.machine, Kind: ValidationKindExecute}
+	} else {
+		return nil
+	}
+
+	_, err := sm.retry(ctx, sm.getRetryPolicy(retry), func() (bool, error) {
+		err := handler()
+		return err == nil, err
+	})
+
+	if err != nil {
+		var conflict *ErrConcurrentModification
+		if errors.As(err, &conflict) {
+			return conflict.fill(run)
+		}
+		return &ErrExecuteFailed{Machine: run.machine, State: run.from, NextState: run.to, Err: err}
+	}
+
+	return nil
+}
+
+// revertState moves the object of a completed run back to its previous state. An object of the state store
+// already back in its previous state (e.g. its write was rolled back with the transaction) is reverted,
+// the execute function does not run again.
+func (sm *StateMachine) revertState(ctx context.Context, run *transitionRun, obj any) error {
+	from, to := run.storedStates()
+	store, objectId := sm.getStateStore()
+	if store != nil {
+		id := objectId(obj)
+		swapped, err := store.CompareAndSet(ctx, id, to, from, run.version+1)
+		if err != nil {
+			return err
+		}
+		if !swapped {
+			state, version, err := store.Get(ctx, id)
+			if err != nil {
+				return err
+			}
+			if state != from || version != run.version {
+				return &ErrConcurrentModification{Machine: run.machine, ObjectId: id, State: run.to, NextState: run.from, Version: run.version + 1}
+			}
+			return nil
+		}
+	}
+
+	if executeVector := sm.getExecuteVectorFunction(); executeVector != nil && run.fromVector != nil {
+		return executeVector(ctx, run.toVector, run.fromVector, run.version+1, obj)
+	}
+
+	if execute := sm.getExecuteFunction(); execute != nil {
+		return execute(ctx, to, from, run.version+1, obj)
+	}
+
+	if store == nil {
+		return &ErrHandlerNotRegistered{Machine: run.machine, Kind: ValidationKindExecute}
+	}
+
+	return nil
+}
+
+// AddConflictRetry sets the number of times a transition failing with an ErrConcurrentModification of its own write
+// is processed again, see ProcessTransitionContext
+func (sm *StateMachine) AddConflictRetry(retries int) {
+	sm.register(func() {
+		sm.conflictRetries = retries
+	})
+}
+
+// WithConflictRetry sets the number of times a transition failing with an ErrConcurrentModification is processed again
+func WithConflictRetry(retries int) Option {
+	return func(sm *StateMachine) {
+		sm.conflictRetries = retries
+	}
+}
+
+func (sm *StateMachine) getConflictRetries() int {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	return sm.conflictRetries
+}
+
+// MemoryStateStore a StateStore in memory, safe for concurrent use
+type MemoryStateStore struct {
+	mux    sync.Mutex
+	states map[string]memoryState
+}
+
+type memoryState struct {
+	state   string
+	version int64
+}
+
+// NewMemoryStateStore creates an empty in-memory state store
+func NewMemoryStateStore() *MemoryStateStore {
+	return &MemoryStateStore{
+		states: make(map[string]memoryState),
+	}
+}
+
+func (s *MemoryStateStore) Get(_ context.Context, id string) (string, int64, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	stored := s.states[id]
+	return stored.state, stored.version, nil
+}
+
+func (s *MemoryStateStore) CompareAndSet(_ context.Context, id, from, to string, version int64) (bool, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	stored := s.states[id]
+	if stored.state != from || stored.version != version {
+		return false, nil
+	}
+
+	s.states[id] = memoryState{state: to, version: version + 1}
+	return true, nil
+}
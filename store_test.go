@@ -0,0 +1,107 @@
+package state_machine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestConflictRetry(t *testing.T) {
+	tests := []struct {
+		name string
+		// conflicts the writes of the other workers, one before each of the first attempts
+		conflicts    int
+		retries      int
+		wantSuccess  bool
+		wantVersions []int64
+		wantAlerts   int
+	}{
+		{
+			name:         "without conflict",
+			retries:      2,
+			wantSuccess:  true,
+			wantVersions: []int64{1},
+		},
+		{
+			name:         "reads the object again and retries",
+			conflicts:    2,
+			retries:      2,
+			wantSuccess:  true,
+			wantVersions: []int64{1, 2, 3},
+		},
+		{
+			name:         "gives up after the retries",
+			conflicts:    3,
+			retries:      2,
+			wantVersions: []int64{1, 2, 3},
+			wantAlerts:   1,
+		},
+		{
+			name:         "without retries",
+			conflicts:    1,
+			wantVersions: []int64{1},
+			wantAlerts:   1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sm := NewStateMachine(WithConflictRetry(test.retries))
+			if err := sm.LoadFromBytes([]byte(`{"name":"orders","states":[
+				{"name":"pending","initial":true,"transitions":[{"name":"paid","check":[{"func":"isPaid"}],"on_error":[{"func":"alert"}]}]},
+				{"name":"paid","final":true}]}`), "json"); err != nil {
+				t.Fatal(err)
+			}
+
+			state, version, conflicts := "pending", int64(1), test.conflicts
+			var versions []int64
+			checks, alerts := 0, 0
+			sm.AddVersionedCurrentStateFunction(func(any) (string, int64, error) { return state, version, nil })
+			sm.AddVersionedExecuteFunction(func(from, nextState string, readVersion int64, _ any) error {
+				versions = append(versions, readVersion)
+				if conflicts > 0 {
+					// another worker updated the object after it was read
+					conflicts--
+					version++
+				}
+				if from != state || readVersion != version {
+					return &ErrConcurrentModification{ObjectId: "order-1"}
+				}
+				state, version = nextState, version+1
+				return nil
+			})
+			sm.AddCheckFunction("isPaid", func(any, ...string) (bool, error) {
+				checks++
+				return true, nil
+			})
+			sm.AddOnErrorFunction("alert", func(any, ...string) (bool, error) {
+				alerts++
+				return true, nil
+			})
+
+			success, err := sm.ProcessTransition("paid", struct{}{})
+			if test.wantSuccess {
+				if !success || err != nil || state != "paid" {
+					t.Errorf("ProcessTransition = %v, %v, state %s, want a success", success, err, state)
+				}
+			} else {
+				var conflict *ErrConcurrentModification
+				wantVersion := test.wantVersions[len(test.wantVersions)-1]
+				if success || !errors.As(err, &conflict) || conflict.Machine != "orders" || conflict.ObjectId != "order-1" ||
+					conflict.State != "pending" || conflict.NextState != "paid" || conflict.Version != wantVersion {
+					t.Errorf("ProcessTransition = %v, %v, want an ErrConcurrentModification of version %d", success, err, wantVersion)
+				}
+			}
+
+			if !reflect.DeepEqual(versions, test.wantVersions) {
+				t.Errorf("versions read = %v, want %v", versions, test.wantVersions)
+			}
+			if checks != len(test.wantVersions) {
+				t.Errorf("checks = %d, want one per attempt: %d", checks, len(test.wantVersions))
+			}
+			if alerts != test.wantAlerts {
+				t.Errorf("on_error calls = %d, want %d", alerts, test.wantAlerts)
+			}
+		})
+	}
+}
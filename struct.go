@@ -1,57 +1,163 @@
 package state_machine
 
+import (
+	"context"
+	"sync"
+	"time"
+)
+
 // StateMachine ...
+//
+// The registration of handlers, the load of definitions and the processing of transitions
+// are safe for concurrent use. Registering after Freeze is rejected with an ErrFrozen panic.
+// The exported handler maps hold the handlers registered without a context, the ones registered with a context
+// take precedence. The maps must not be written directly once the machine is in use, the changes made after Freeze
+// are ignored.
 type StateMachine struct {
-	Name                      string                            `json:"name"`
-	execute                   HandlerExecFunction               `json:"execute"`
-	stateMachinesToTriggerMap map[string]IStateMachine          `json:"state_machines_to_trigger_map"`
-	currentState              CurrentStateFunc                  `json:"current_state"`
-	States                    []StateInput                      `json:"states"`
-	MapStates                 map[string]map[string]Handlers    `json:"map_states"`
-	OnSuccessHandlers         map[string]HandlerFunc            `json:"on_success_handlers"`
-	OnErrorHandlers           map[string]HandlerFunc            `json:"on_error_handlers"`
-	CheckHandlers             map[string]HandlerFunc            `json:"check_handlers"`
-	FilterHandlers            map[string]HandlerFilterFunction  `json:"filter_handlers"`
-	AdapterHandlers           map[string]HandlerAdapterFunction `json:"adapter_handlers"`
+	Name                      string                              `json:"name"`
+	execute                   HandlerVersionedExecFunctionContext `json:"-"`
+	stateMachinesToTriggerMap map[string]IStateMachine            `json:"-"`
+	currentState              VersionedCurrentStateFuncContext    `json:"-"`
+	States                    []StateInput                        `json:"states"`
+	MapStates                 map[string]map[string]Handlers      `json:"map_states"`
+	OnSuccessHandlers         map[string]HandlerFunc              `json:"on_success_handlers"`
+	OnErrorHandlers           map[string]HandlerFunc              `json:"on_error_handlers"`
+	CheckHandlers             map[string]HandlerFunc              `json:"check_handlers"`
+	FilterHandlers            map[string]HandlerFilterFunction    `json:"filter_handlers"`
+	AdapterHandlers           map[string]HandlerAdapterFunction   `json:"adapter_handlers"`
+	CompensateHandlers        map[string]HandlerFunc              `json:"compensate_handlers"`
+	onSuccessHandlers         map[string]HandlerFuncContext
+	onErrorHandlers           map[string]HandlerFuncContext
+	checkHandlers             map[string]HandlerFuncContext
+	filterHandlers            map[string]HandlerFilterFunctionContext
+	adapterHandlers           map[string]HandlerAdapterFunctionContext
+	compensateHandlers        map[string]HandlerFuncContext
+	OnEnter                   map[string][]OnSuccessStruct `json:"on_enter"`
+	OnExit                    map[string][]OnSuccessStruct `json:"on_exit"`
+	BeforeTransition          []OnSuccessStruct            `json:"before_transition"`
+	AfterTransition           []OnSuccessStruct            `json:"after_transition"`
+	initialState              string
+	initialHandlers           Handlers
+	finalStates               map[string]bool
+	events                    map[string]map[string]string
+	parents                   map[string]string
+	initialChildren           map[string]string
+	regions                   []string
+	stateRegions              map[string]string
+	regionInitials            map[string]string
+	stateVector               StateVectorFuncContext
+	executeVector             HandlerExecVectorFunctionContext
+	auditSinks                []AuditSink
+	auditObjectId             func(obj any) string
+	txManager                 TxManager
+	stateStore                StateStore
+	stateStoreObjectId        func(obj any) string
+	conflictRetries           int
+	timerStore                TimerStore
+	timerObjectId             func(obj any) string
+	clock                     Clock
+	retryPolicy               *RetryPolicy
+	retryClassifier           RetryClassifier
+	validateOnTransition      bool
+	validated                 bool
+	frozen                    bool
+	mux                       sync.RWMutex
+}
+
+// Definition the definition document of a state machine
+type Definition struct {
+	Name             string                 `json:"name"`
+	BeforeTransition []OnSuccessInputStruct `json:"before_transition,omitempty" mapstructure:"before_transition"`
+	AfterTransition  []OnSuccessInputStruct `json:"after_transition,omitempty" mapstructure:"after_transition"`
+	States           []StateInput           `json:"states"`
+	Regions          []RegionInput          `json:"regions,omitempty"`
 }
 
 type StateInput struct {
-	Name        string            `json:"name"`
-	Transitions []TransitionInput `json:"transitions"`
+	Name         string                 `json:"name"`
+	Initial      bool                   `json:"initial,omitempty"`
+	Final        bool                   `json:"final,omitempty"`
+	Parent       string                 `json:"parent,omitempty"`
+	InitialChild string                 `json:"initial_child,omitempty" mapstructure:"initial_child"`
+	Create       *TransitionInput       `json:"create,omitempty"`
+	OnEnter      []OnSuccessInputStruct `json:"on_enter,omitempty" mapstructure:"on_enter"`
+	OnExit       []OnSuccessInputStruct `json:"on_exit,omitempty" mapstructure:"on_exit"`
+	Transitions  []TransitionInput      `json:"transitions,omitempty"`
+}
+
+// JoinInput the state a region must be in for a join transition.
+// The joins are a list rather than a map, the decoder of the definitions would lowercase the region names of its keys.
+type JoinInput struct {
+	Region string `json:"region"`
+	State  string `json:"state"`
 }
 
 type TransitionInput struct {
-	// Name
-	Name string `json:"name"`
+	// Name of the next state
+	Name string `json:"name,omitempty"`
+	// Event that fires the transition, see Fire
+	Event string `json:"event,omitempty"`
+	// Join the states of the regions required by the transition, processed once they are reached
+	Join []JoinInput `json:"join,omitempty"`
+	// After the duration in the state (e.g. 48h) the transition is processed by the scheduler, see ProcessDueTimers
+	After string `json:"after,omitempty"`
+	// Retry policy of the execute function in the transition. With a TxManager the retries run in the same
+	// transaction, they are not transactional: a database aborting the transaction on a failed statement
+	// (e.g. Postgres) fails the retries too, unless execute rolls back to a savepoint of its own.
+	Retry *RetryPolicyInput `json:"retry,omitempty"`
+	// Guard expression
+	Guard *GuardInput `json:"guard,omitempty" mapstructure:"guard"`
 	// Check
-	Check []CheckInputStruct `json:"check" mapstructure:"check"`
+	Check []CheckInputStruct `json:"check,omitempty" mapstructure:"check"`
 	// On Success
-	OnSuccess []OnSuccessInputStruct `json:"on_success"  mapstructure:"on_success"`
+	OnSuccess []OnSuccessInputStruct `json:"on_success,omitempty"  mapstructure:"on_success"`
 	// On Error
-	OnError []OnErrorInputStruct `json:"on_error" mapstructure:"on_error"`
+	OnError []OnErrorInputStruct `json:"on_error,omitempty" mapstructure:"on_error"`
 }
 
+// CheckInputStruct a check function, or an all/any/not group of checks
 type CheckInputStruct struct {
-	Func string `json:"func"`
+	Func            string             `json:"func,omitempty"`
+	FuncArg         []string           `json:"func_arg,omitempty" mapstructure:"func_arg"`
+	All             []CheckInputStruct `json:"all,omitempty"`
+	Any             []CheckInputStruct `json:"any,omitempty"`
+	Not             *CheckInputStruct  `json:"not,omitempty"`
+	IgnoreError     bool               `json:"ignore_error,omitempty" mapstructure:"ignore_error"`
+	IgnoreNoSuccess bool               `json:"ignore_no_success,omitempty" mapstructure:"ignore_no_success"`
 }
 
 type OnSuccessInputStruct struct {
-	Func            string   `json:"func"`
-	FuncArg         []string `json:"func_arg"`
-	Adapter         string   `json:"adapter"`
-	Filter          string   `json:"filter"`
-	IsStateMachine  bool     `json:"is_state_machine" mapstructure:"is_state_machine"`
-	IgnoreError     bool     `json:"ignore_error,omitempty" mapstructure:"ignore_error"`
-	IgnoreNoSuccess bool     `json:"ignore_no_success,omitempty" mapstructure:"ignore_no_success"`
+	Func            string            `json:"func"`
+	FuncArg         []string          `json:"func_arg,omitempty" mapstructure:"func_arg"`
+	Adapter         string            `json:"adapter,omitempty"`
+	Filter          string            `json:"filter,omitempty"`
+	IsStateMachine  bool              `json:"is_state_machine,omitempty" mapstructure:"is_state_machine"`
+	Compensate      string            `json:"compensate,omitempty"`
+	Retry           *RetryPolicyInput `json:"retry,omitempty"`
+	IgnoreError     bool              `json:"ignore_error,omitempty" mapstructure:"ignore_error"`
+	IgnoreNoSuccess bool              `json:"ignore_no_success,omitempty" mapstructure:"ignore_no_success"`
 }
 
 type OnErrorInputStruct struct {
-	Func string `json:"func"`
+	Func            string   `json:"func"`
+	FuncArg         []string `json:"func_arg,omitempty" mapstructure:"func_arg"`
+	IgnoreError     bool     `json:"ignore_error,omitempty" mapstructure:"ignore_error"`
+	IgnoreNoSuccess bool     `json:"ignore_no_success,omitempty" mapstructure:"ignore_no_success"`
 }
 
 type Handlers struct {
 	// Update Status
 	updateStatus string
+	// Event
+	Event string `json:"event,omitempty"`
+	// Join
+	Join map[string]string `json:"join,omitempty"`
+	// After
+	After time.Duration `json:"after,omitempty"`
+	// Retry
+	Retry *RetryPolicy `json:"retry,omitempty"`
+	// Guard
+	Guard *Guard `json:"guard,omitempty"`
 	// Check
 	Check []CheckStruct `json:"check"`
 	// On Success
@@ -60,21 +166,28 @@ type Handlers struct {
 	OnError []OnErrorStruct `json:"on_error"`
 }
 
+// CheckStruct a check function, or an all/any/not group of checks
 type CheckStruct struct {
-	Func            string   `json:"func"`
-	FuncArg         []string `json:"func_arg"`
-	IgnoreError     bool     `json:"ignore_error,omitempty" mapstructure:"ignore_error"`
-	IgnoreNoSuccess bool     `json:"ignore_no_success,omitempty" mapstructure:"ignore_no_success"`
+	Func            string        `json:"func"`
+	FuncArg         []string      `json:"func_arg"`
+	All             []CheckStruct `json:"all,omitempty"`
+	Any             []CheckStruct `json:"any,omitempty"`
+	Not             *CheckStruct  `json:"not,omitempty"`
+	IgnoreError     bool          `json:"ignore_error,omitempty" mapstructure:"ignore_error"`
+	IgnoreNoSuccess bool          `json:"ignore_no_success,omitempty" mapstructure:"ignore_no_success"`
 }
 
 type OnSuccessStruct struct {
-	Func            string   `json:"func"`
-	FuncArg         []string `json:"func_arg"`
-	Adapter         string   `json:"adapter"`
-	Filter          string   `json:"filter"`
-	IsStateMachine  bool     `json:"is_state_machine" mapstructure:"is_state_machine"`
-	IgnoreError     bool     `json:"ignore_error,omitempty" mapstructure:"ignore_error"`
-	IgnoreNoSuccess bool     `json:"ignore_no_success,omitempty" mapstructure:"ignore_no_success"`
+	Func            string       `json:"func"`
+	FuncArg         []string     `json:"func_arg"`
+	Adapter         string       `json:"adapter"`
+	Filter          string       `json:"filter"`
+	IsStateMachine  bool         `json:"is_state_machine" mapstructure:"is_state_machine"`
+	Compensate      string       `json:"compensate,omitempty"`
+	CompensateArg   []string     `json:"compensate_arg,omitempty"`
+	Retry           *RetryPolicy `json:"retry,omitempty"`
+	IgnoreError     bool         `json:"ignore_error,omitempty" mapstructure:"ignore_error"`
+	IgnoreNoSuccess bool         `json:"ignore_no_success,omitempty" mapstructure:"ignore_no_success"`
 }
 
 type OnErrorStruct struct {
@@ -89,3 +202,17 @@ type HandlerFilterFunction func(objs []any) ([]any, error)
 type HandlerExecFunction func(nextState string, obj any) (err error)
 type HandlerFunc func(arg any, optArg ...string) (success bool, err error)
 type CurrentStateFunc func(obj any) (string, error)
+type HandlerVersionedExecFunction func(from, nextState string, version int64, obj any) (err error)
+type VersionedCurrentStateFunc func(obj any) (state string, version int64, err error)
+type StateVectorFunc func(obj any) (vector StateVector, version int64, err error)
+type HandlerExecVectorFunction func(from, to StateVector, version int64, obj any) (err error)
+
+type HandlerAdapterFunctionContext func(ctx context.Context, obj any) ([]any, error)
+type HandlerFilterFunctionContext func(ctx context.Context, objs []any) ([]any, error)
+type HandlerExecFunctionContext func(ctx context.Context, nextState string, obj any) (err error)
+type HandlerFuncContext func(ctx context.Context, arg any, optArg ...string) (success bool, err error)
+type CurrentStateFuncContext func(ctx context.Context, obj any) (string, error)
+type HandlerVersionedExecFunctionContext func(ctx context.Context, from, nextState string, version int64, obj any) (err error)
+type VersionedCurrentStateFuncContext func(ctx context.Context, obj any) (state string, version int64, err error)
+type StateVectorFuncContext func(ctx context.Context, obj any) (vector StateVector, version int64, err error)
+type HandlerExecVectorFunctionContext func(ctx context.Context, from, to StateVector, version int64, obj any) (err error)
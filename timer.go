@@ -0,0 +1,309 @@
+package state_machine
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock gives the time to the scheduled transitions
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// ManualClock a clock moved by hand, so the tests advance the time of the scheduled transitions deterministically
+type ManualClock struct {
+	mux sync.Mutex
+	now time.Time
+}
+
+// NewManualClock creates a manual clock at the given time
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set moves the clock to the given time
+func (c *ManualClock) Set(now time.Time) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.now = now
+}
+
+// Timer a pending scheduled transition of an object
+type Timer struct {
+	// Machine
+	Machine string `json:"machine"`
+	// ObjectId
+	ObjectId string `json:"object_id"`
+	// State entered by the object, the transition is skipped once the object left it
+	State string `json:"state"`
+	// NextState
+	NextState string `json:"next_state"`
+	// Due time of the transition
+	Due time.Time `json:"due"`
+}
+
+// TimerStore keeps the pending timers of the scheduled transitions
+type TimerStore interface {
+	// Schedule adds the timer, replacing the one of the same machine, object, state and next state
+	Schedule(ctx context.Context, timer Timer) error
+	// Due returns the timers of the machine due at the given time, by due time
+	Due(ctx context.Context, machine string, now time.Time) ([]Timer, error)
+	// Delete removes the timer when it is still the one due at its due time
+	Delete(ctx context.Context, timer Timer) error
+}
+
+// ObjectLoader loads the object of a timer to process its scheduled transition
+type ObjectLoader func(ctx context.Context, objectId string) (any, error)
+
+// AddTimerStore sets the store of the timers of the transitions with an after duration,
+// objectId identifies the objects in the timers
+func (sm *StateMachine) AddTimerStore(store TimerStore, objectId func(obj any) string) {
+	sm.register(func() {
+		sm.timerStore = store
+		sm.timerObjectId = objectId
+	})
+}
+
+// WithTimerStore sets the store of the timers of the transitions with an after duration, see AddTimerStore
+func WithTimerStore(store TimerStore, objectId func(obj any) string) Option {
+	return func(sm *StateMachine) {
+		sm.timerStore = store
+		sm.timerObjectId = objectId
+	}
+}
+
+// AddClock sets the clock of the scheduled transitions, the system clock by default
+func (sm *StateMachine) AddClock(clock Clock) {
+	sm.register(func() {
+		sm.clock = clock
+	})
+}
+
+// WithClock sets the clock of the scheduled transitions, the system clock by default
+func WithClock(clock Clock) Option {
+	return func(sm *StateMachine) {
+		sm.clock = clock
+	}
+}
+
+func (sm *StateMachine) getTimerStore() (TimerStore, func(obj any) string, Clock) {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+
+	clock := sm.clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+
+	return sm.timerStore, sm.timerObjectId, clock
+}
+
+// scheduleTimers schedules the transitions with an after duration of the states entered by the run
+func (sm *StateMachine) scheduleTimers(ctx context.Context, run *transitionRun, obj any) (bool, error) {
+	store, objectId, clock := sm.getTimerStore()
+	if store == nil {
+		return true, nil
+	}
+
+	now := clock.Now()
+	for _, timer := range sm.getEnteredTimers(run) {
+		timer.ObjectId = objectId(obj)
+		timer.Due = now.Add(timer.after)
+		if err := store.Schedule(ctx, timer.Timer); err != nil {
+			run.fail(transitionStageSchedule, timer.NextState, err)
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// enteredTimer a timer of a state entered by a run, due after its duration
+type enteredTimer struct {
+	Timer
+	after time.Duration
+}
+
+// getEnteredTimers returns the timers of the transitions with an after duration of the states entered by the run,
+// with the initial states of the regions on the first transition
+func (sm *StateMachine) getEnteredTimers(run *transitionRun) (timers []enteredTimer) {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+
+	entered := sm.exitedStates(run.to, run.from)
+	if run.from == "" {
+		entered = sm.lineage(run.to)
+		for _, region := range sm.regions {
+			if state := run.toVector[region]; state != "" {
+				entered = append(entered, sm.lineage(state)...)
+			}
+		}
+	}
+
+	for _, state := range entered {
+		for _, nextState := range sortedKeys(sm.MapStates[state]) {
+			if after := sm.MapStates[state][nextState].After; after > 0 {
+				timers = append(timers, enteredTimer{Timer: Timer{Machine: sm.Name, State: state, NextState: nextState}, after: after})
+			}
+		}
+	}
+
+	return timers
+}
+
+// ProcessDueTimers processes the scheduled transitions due at the time of the clock through the check, execute
+// and on_success pipeline. A timer is removed once processed, skipped because the object left its state or rejected,
+// it is kept to be processed again when the transition fails with any other error.
+func (sm *StateMachine) ProcessDueTimers(ctx context.Context, load ObjectLoader) (processed int, err error) {
+	store, _, clock := sm.getTimerStore()
+	if store == nil {
+		return 0, &ErrHandlerNotRegistered{Machine: sm.GetName(), Kind: ValidationKindTimerStore}
+	}
+
+	timers, err := store.Due(ctx, sm.GetName(), clock.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	var errs []error
+	for _, timer := range timers {
+		if err = ctx.Err(); err != nil {
+			return processed, errors.Join(append(errs, err)...)
+		}
+
+		obj, err := load(ctx, timer.ObjectId)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		_, err = sm.processTransitionWithRetry(ctx, transitionRequest{nextState: timer.NextState, within: timer.State}, obj)
+		if err != nil && !errors.Is(err, &ErrCheckRejected{}) && !errors.Is(err, &ErrTransitionNotAllowed{}) {
+			errs = append(errs, err)
+			continue
+		}
+
+		if err = store.Delete(ctx, timer); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		processed++
+	}
+
+	return processed, errors.Join(errs...)
+}
+
+// Scheduler processes the due scheduled transitions of a state machine periodically
+type Scheduler struct {
+	machine  ITimers
+	load     ObjectLoader
+	interval time.Duration
+}
+
+// NewScheduler creates a scheduler of the state machine, checking the due timers at every interval
+func NewScheduler(machine ITimers, load ObjectLoader, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		machine:  machine,
+		load:     load,
+		interval: interval,
+	}
+}
+
+// Tick processes the timers due now, e.g. after advancing a ManualClock in a test
+func (s *Scheduler) Tick(ctx context.Context) (int, error) {
+	return s.machine.ProcessDueTimers(ctx, s.load)
+}
+
+// Run processes the due timers at every interval until the context is done, onError receives the errors of the ticks
+func (s *Scheduler) Run(ctx context.Context, onError func(error)) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if _, err := s.Tick(ctx); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// MemoryTimerStore a TimerStore in memory, safe for concurrent use
+type MemoryTimerStore struct {
+	mux    sync.Mutex
+	timers map[Timer]Timer
+}
+
+// NewMemoryTimerStore creates an empty in-memory timer store
+func NewMemoryTimerStore() *MemoryTimerStore {
+	return &MemoryTimerStore{
+		timers: make(map[Timer]Timer),
+	}
+}
+
+func (s *MemoryTimerStore) Schedule(_ context.Context, timer Timer) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.timers[timerKey(timer)] = timer
+	return nil
+}
+
+func (s *MemoryTimerStore) Due(_ context.Context, machine string, now time.Time) (timers []Timer, err error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for _, timer := range s.timers {
+		if timer.Machine == machine && !timer.Due.After(now) {
+			timers = append(timers, timer)
+		}
+	}
+
+	sort.Slice(timers, func(i, j int) bool {
+		return timers[i].Due.Before(timers[j].Due)
+	})
+
+	return timers, nil
+}
+
+func (s *MemoryTimerStore) Delete(_ context.Context, timer Timer) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	key := timerKey(timer)
+	if stored, ok := s.timers[key]; ok && stored.Due.Equal(timer.Due) {
+		delete(s.timers, key)
+	}
+
+	return nil
+}
+
+// timerKey the timer without its due time
+func timerKey(timer Timer) Timer {
+	timer.Due = time.Time{}
+	return timer
+}
@@ -0,0 +1,116 @@
+package state_machine
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+const timerDefinition = `{"name":"orders","states":[
+	{"name":"pending","initial":true,"create":{"name":"pending"},"transitions":[{"name":"expired","after":"48h","check":[{"func":"isUnpaid"}]},{"name":"paid"}]},
+	{"name":"paid","transitions":[{"name":"shipped","after":"1h"}]},
+	{"name":"shipped","final":true},
+	{"name":"expired","final":true}]}`
+
+type timerOrder struct {
+	id   string
+	paid bool
+}
+
+func newTimerMachine(t *testing.T) (*StateMachine, *ManualClock, *MemoryStateStore, *MemoryTimerStore, *sync.Map) {
+	t.Helper()
+
+	states := NewMemoryStateStore()
+	timers := NewMemoryTimerStore()
+	clock := NewManualClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	objectId := func(obj any) string { return obj.(*timerOrder).id }
+
+	sm := NewStateMachine(WithStateStore(states, objectId), WithTimerStore(timers, objectId), WithClock(clock))
+	if err := sm.LoadFromBytes([]byte(timerDefinition), "json"); err != nil {
+		t.Fatal(err)
+	}
+	sm.AddCheckFunction("isUnpaid", func(obj any, _ ...string) (bool, error) { return !obj.(*timerOrder).paid, nil })
+
+	return sm, clock, states, timers, &sync.Map{}
+}
+
+func TestProcessDueTimers(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		advance   time.Duration
+		paid      bool
+		wantState string
+		wantKept  int
+	}{
+		{name: "keeps the timers not due yet", advance: 47 * time.Hour, wantState: "pending", wantKept: 1},
+		{name: "fires the due timers", advance: 48 * time.Hour, wantState: "expired", wantKept: 0},
+		{name: "deletes the timers whose check rejects", advance: 48 * time.Hour, paid: true, wantState: "pending", wantKept: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sm, clock, states, timers, objects := newTimerMachine(t)
+
+			order := &timerOrder{id: "order-1", paid: test.paid}
+			objects.Store(order.id, order)
+			if _, err := sm.ProcessInitialTransition(order); err != nil {
+				t.Fatal(err)
+			}
+
+			clock.Advance(test.advance)
+			scheduler := NewScheduler(sm, func(_ context.Context, id string) (any, error) {
+				obj, _ := objects.Load(id)
+				return obj, nil
+			}, time.Minute)
+			if _, err := scheduler.Tick(ctx); err != nil {
+				t.Fatalf("Tick: %v", err)
+			}
+
+			if state, _, _ := states.Get(ctx, order.id); state != test.wantState {
+				t.Errorf("state = %s, want %s", state, test.wantState)
+			}
+			pending, _ := timers.Due(ctx, "orders", clock.Now().Add(1000*time.Hour))
+			if len(pending) != test.wantKept {
+				t.Errorf("pending timers = %v, want %d", pending, test.wantKept)
+			}
+		})
+	}
+}
+
+func TestProcessDueTimersSkipsLeftStates(t *testing.T) {
+	ctx := context.Background()
+	sm, clock, states, timers, _ := newTimerMachine(t)
+
+	order := &timerOrder{id: "order-1", paid: true}
+	if _, err := sm.ProcessInitialTransition(order); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sm.ProcessTransition("paid", order); err != nil {
+		t.Fatal(err)
+	}
+
+	load := func(context.Context, string) (any, error) { return order, nil }
+
+	clock.Advance(time.Hour)
+	if processed, err := sm.ProcessDueTimers(ctx, load); err != nil || processed != 1 {
+		t.Fatalf("ProcessDueTimers = %d, %v, want 1, nil", processed, err)
+	}
+	if state, _, _ := states.Get(ctx, order.id); state != "shipped" {
+		t.Errorf("state = %s, want shipped", state)
+	}
+
+	// the expiration of the pending state is stale once the order left it
+	clock.Advance(48 * time.Hour)
+	if processed, err := sm.ProcessDueTimers(ctx, load); err != nil || processed != 1 {
+		t.Fatalf("ProcessDueTimers = %d, %v, want 1, nil", processed, err)
+	}
+	if state, _, _ := states.Get(ctx, order.id); state != "shipped" {
+		t.Errorf("state = %s, want shipped", state)
+	}
+	if pending, _ := timers.Due(ctx, "orders", clock.Now()); len(pending) != 0 {
+		t.Errorf("pending timers = %v, want none", pending)
+	}
+}
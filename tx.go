@@ -0,0 +1,104 @@
+package state_machine
+
+import (
+	"context"
+)
+
+// TxManager begins the transaction of a transition. The transaction starts before execute
+// and is committed once execute, on_enter, on_success (including the triggered state machines)
+// and after_transition succeed, otherwise it is rolled back before the on_error handlers run.
+//
+// The triggered state machines join the transaction of the transition that triggered them,
+// the handlers get it from their context with TxFromContext.
+type TxManager interface {
+	Begin(ctx context.Context) (Tx, error)
+}
+
+// Tx a transaction begun by a TxManager
+type Tx interface {
+	Commit() error
+	Rollback() error
+}
+
+type txContextKey struct{}
+
+// TxFromContext returns the transaction of the transition running the handler
+func TxFromContext(ctx context.Context) (Tx, bool) {
+	tx, ok := ctx.Value(txContextKey{}).(Tx)
+	return tx, ok
+}
+
+// ContextWithTx returns a context carrying the transaction, a transition processed with it joins the transaction
+func ContextWithTx(ctx context.Context, tx Tx) context.Context {
+	return context.WithValue(ctx, txContextKey{}, tx)
+}
+
+// AddTxManager sets the manager of the transactions of the transitions
+func (sm *StateMachine) AddTxManager(manager TxManager) {
+	sm.register(func() {
+		sm.txManager = manager
+	})
+}
+
+// WithTxManager sets the manager of the transactions of the transitions
+func WithTxManager(manager TxManager) Option {
+	return func(sm *StateMachine) {
+		sm.txManager = manager
+	}
+}
+
+func (sm *StateMachine) getTxManager() TxManager {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	return sm.txManager
+}
+
+// transitionTx the transaction of a transition, only the transition that began it commits or rolls it back
+type transitionTx struct {
+	machine string
+	tx      Tx
+	owner   bool
+}
+
+// beginTx begins a transaction, or joins the one in the context
+func (sm *StateMachine) beginTx(ctx context.Context, run *transitionRun) (context.Context, *transitionTx, error) {
+	if tx, ok := TxFromContext(ctx); ok {
+		return ctx, &transitionTx{machine: run.machine, tx: tx}, nil
+	}
+
+	manager := sm.getTxManager()
+	if manager == nil {
+		return ctx, &transitionTx{machine: run.machine}, nil
+	}
+
+	tx, err := manager.Begin(ctx)
+	if err != nil {
+		return ctx, nil, &ErrTransactionFailed{Machine: run.machine, Op: "begin", Err: err}
+	}
+
+	return ContextWithTx(ctx, tx), &transitionTx{machine: run.machine, tx: tx, owner: true}, nil
+}
+
+func (t *transitionTx) commit() error {
+	if !t.owner {
+		return nil
+	}
+
+	if err := t.tx.Commit(); err != nil {
+		return &ErrTransactionFailed{Machine: t.machine, Op: "commit", Err: err}
+	}
+
+	return nil
+}
+
+func (t *transitionTx) rollback() error {
+	if !t.owner {
+		return nil
+	}
+
+	if err := t.tx.Rollback(); err != nil {
+		return &ErrTransactionFailed{Machine: t.machine, Op: "rollback", Err: err}
+	}
+
+	return nil
+}
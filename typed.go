@@ -0,0 +1,242 @@
+package state_machine
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+type TypedHandlerFunc[T any] func(ctx context.Context, obj T, optArg ...string) (success bool, err error)
+type TypedHandlerExecFunction[T any] func(ctx context.Context, nextState string, obj T) (err error)
+type TypedCurrentStateFunc[T any] func(ctx context.Context, obj T) (string, error)
+type TypedHandlerVersionedExecFunction[T any] func(ctx context.Context, from, nextState string, version int64, obj T) (err error)
+type TypedVersionedCurrentStateFunc[T any] func(ctx context.Context, obj T) (state string, version int64, err error)
+type TypedHandlerFilterFunction[T any] func(ctx context.Context, objs []T) ([]T, error)
+type TypedHandlerAdapterFunction[T any, U any] func(ctx context.Context, obj T) ([]U, error)
+
+// AnyStateMachine is implemented by the untyped and the typed state machines
+type AnyStateMachine interface {
+	Untyped() IStateMachine
+}
+
+// TypedStateMachine wraps a state machine so its handlers are typed on the object.
+// The definitions, the validation, the export and the audit are the ones of the wrapped state machine,
+// the untyped methods stay available through the embedded *StateMachine.
+//
+//	sm := NewTyped[Order]()
+//	sm.AddCheckFunction("auth", func(ctx context.Context, order Order, roles ...string) (bool, error) { ... })
+//	success, err := sm.ProcessTransition("paid", order)
+//
+// The handlers get the object given to the transition. Type the state machine on the pointer (e.g. NewTyped[*Order])
+// when the handlers change the object, any other type (a *Order given to a machine typed on Order too) is rejected
+// with an ErrUnexpectedObject rather than copied.
+type TypedStateMachine[T any] struct {
+	*StateMachine
+}
+
+// NewTyped creates a state machine typed on T
+func NewTyped[T any](opts ...Option) *TypedStateMachine[T] {
+	return Typed[T](NewStateMachine(opts...))
+}
+
+// Typed wraps an existing state machine (e.g. built with a Builder) so its handlers are typed on T
+func Typed[T any](sm *StateMachine) *TypedStateMachine[T] {
+	return &TypedStateMachine[T]{StateMachine: sm}
+}
+
+// Untyped returns the wrapped state machine, e.g. to trigger it from another state machine
+func (t *TypedStateMachine[T]) Untyped() IStateMachine {
+	return t.StateMachine
+}
+
+func (t *TypedStateMachine[T]) ProcessTransition(nextState string, obj T) (bool, error) {
+	return t.StateMachine.ProcessTransitionContext(context.Background(), nextState, obj)
+}
+
+func (t *TypedStateMachine[T]) ProcessTransitionContext(ctx context.Context, nextState string, obj T) (bool, error) {
+	return t.StateMachine.ProcessTransitionContext(ctx, nextState, obj)
+}
+
+func (t *TypedStateMachine[T]) ProcessInitialTransition(obj T) (bool, error) {
+	return t.StateMachine.ProcessInitialTransitionContext(context.Background(), obj)
+}
+
+func (t *TypedStateMachine[T]) ProcessInitialTransitionContext(ctx context.Context, obj T) (bool, error) {
+	return t.StateMachine.ProcessInitialTransitionContext(ctx, obj)
+}
+
+func (t *TypedStateMachine[T]) CanTransition(nextState string, obj T) (TransitionEvaluation, error) {
+	return t.StateMachine.CanTransitionContext(context.Background(), nextState, obj)
+}
+
+func (t *TypedStateMachine[T]) CanTransitionContext(ctx context.Context, nextState string, obj T) (TransitionEvaluation, error) {
+	return t.StateMachine.CanTransitionContext(ctx, nextState, obj)
+}
+
+func (t *TypedStateMachine[T]) AvailableTransitions(obj T) ([]TransitionEvaluation, error) {
+	return t.StateMachine.AvailableTransitionsContext(context.Background(), obj)
+}
+
+func (t *TypedStateMachine[T]) AvailableTransitionsContext(ctx context.Context, obj T) ([]TransitionEvaluation, error) {
+	return t.StateMachine.AvailableTransitionsContext(ctx, obj)
+}
+
+func (t *TypedStateMachine[T]) Fire(event string, obj T) (bool, error) {
+	return t.StateMachine.FireContext(context.Background(), event, obj)
+}
+
+func (t *TypedStateMachine[T]) FireContext(ctx context.Context, event string, obj T) (bool, error) {
+	return t.StateMachine.FireContext(ctx, event, obj)
+}
+
+func (t *TypedStateMachine[T]) CanFire(event string, obj T) (TransitionEvaluation, error) {
+	return t.StateMachine.CanFireContext(context.Background(), event, obj)
+}
+
+func (t *TypedStateMachine[T]) CanFireContext(ctx context.Context, event string, obj T) (TransitionEvaluation, error) {
+	return t.StateMachine.CanFireContext(ctx, event, obj)
+}
+
+func (t *TypedStateMachine[T]) AddCheckFunction(name string, handler TypedHandlerFunc[T]) {
+	t.StateMachine.AddCheckFunctionContext(name, typedHandlerFunc(t.StateMachine, handler))
+}
+
+func (t *TypedStateMachine[T]) AddOnSuccessFunction(name string, handler TypedHandlerFunc[T]) {
+	t.StateMachine.AddOnSuccessFunctionContext(name, typedHandlerFunc(t.StateMachine, handler))
+}
+
+func (t *TypedStateMachine[T]) AddOnErrorFunction(name string, handler TypedHandlerFunc[T]) {
+	t.StateMachine.AddOnErrorFunctionContext(name, typedHandlerFunc(t.StateMachine, handler))
+}
+
+func (t *TypedStateMachine[T]) AddCompensateFunction(name string, handler TypedHandlerFunc[T]) {
+	t.StateMachine.AddCompensateFunctionContext(name, typedHandlerFunc(t.StateMachine, handler))
+}
+
+func (t *TypedStateMachine[T]) AddExecuteFunction(handler TypedHandlerExecFunction[T]) {
+	t.StateMachine.AddExecuteFunctionContext(func(ctx context.Context, nextState string, obj any) error {
+		typedObj, err := typedObject[T](t.StateMachine, obj)
+		if err != nil {
+			return err
+		}
+		return handler(ctx, nextState, typedObj)
+	})
+}
+
+func (t *TypedStateMachine[T]) AddCurrentStateFunction(handler TypedCurrentStateFunc[T]) {
+	t.StateMachine.AddCurrentStateFunctionContext(func(ctx context.Context, obj any) (string, error) {
+		typedObj, err := typedObject[T](t.StateMachine, obj)
+		if err != nil {
+			return "", err
+		}
+		return handler(ctx, typedObj)
+	})
+}
+
+func (t *TypedStateMachine[T]) AddVersionedExecuteFunction(handler TypedHandlerVersionedExecFunction[T]) {
+	t.StateMachine.AddVersionedExecuteFunctionContext(func(ctx context.Context, from, nextState string, version int64, obj any) error {
+		typedObj, err := typedObject[T](t.StateMachine, obj)
+		if err != nil {
+			return err
+		}
+		return handler(ctx, from, nextState, version, typedObj)
+	})
+}
+
+func (t *TypedStateMachine[T]) AddVersionedCurrentStateFunction(handler TypedVersionedCurrentStateFunc[T]) {
+	t.StateMachine.AddVersionedCurrentStateFunctionContext(func(ctx context.Context, obj any) (string, int64, error) {
+		typedObj, err := typedObject[T](t.StateMachine, obj)
+		if err != nil {
+			return "", 0, err
+		}
+		return handler(ctx, typedObj)
+	})
+}
+
+// AddFilterFunction adds a filter of the objects of the state machine, see AddTypedFilter to filter adapted objects
+func (t *TypedStateMachine[T]) AddFilterFunction(name string, handler TypedHandlerFilterFunction[T]) {
+	AddTypedFilter[T, T](t, name, handler)
+}
+
+// AddAdapterFunction adds an adapter to objects of the same type, see AddTypedAdapter to adapt to another type
+func (t *TypedStateMachine[T]) AddAdapterFunction(name string, handler TypedHandlerAdapterFunction[T, T]) {
+	AddTypedAdapter[T, T](t, name, handler)
+}
+
+// AddStateMachineToTrigger adds a typed or untyped state machine to trigger
+func (t *TypedStateMachine[T]) AddStateMachineToTrigger(name string, sm AnyStateMachine) IStateMachine {
+	return t.StateMachine.AddStateMachineToTrigger(name, sm.Untyped())
+}
+
+// AddTypedAdapter adds an adapter from the objects of the state machine to the objects of another type U,
+// typically the objects of a triggered state machine typed on U
+func AddTypedAdapter[T any, U any](t *TypedStateMachine[T], name string, handler TypedHandlerAdapterFunction[T, U]) {
+	t.StateMachine.AddAdapterFunctionContext(name, func(ctx context.Context, obj any) ([]any, error) {
+		typedObj, err := typedObject[T](t.StateMachine, obj)
+		if err != nil {
+			return nil, err
+		}
+
+		adapted, err := handler(ctx, typedObj)
+		if err != nil {
+			return nil, err
+		}
+
+		objs := make([]any, 0, len(adapted))
+		for _, item := range adapted {
+			objs = append(objs, item)
+		}
+
+		return objs, nil
+	})
+}
+
+// AddTypedFilter adds a filter of objects of type U, the objects of the state machine or the ones of an adapter
+func AddTypedFilter[T any, U any](t *TypedStateMachine[T], name string, handler TypedHandlerFilterFunction[U]) {
+	t.StateMachine.AddFilterFunctionContext(name, func(ctx context.Context, objs []any) ([]any, error) {
+		typedObjs := make([]U, 0, len(objs))
+		for _, obj := range objs {
+			typedObj, err := typedObject[U](t.StateMachine, obj)
+			if err != nil {
+				return nil, err
+			}
+			typedObjs = append(typedObjs, typedObj)
+		}
+
+		filtered, err := handler(ctx, typedObjs)
+		if err != nil {
+			return nil, err
+		}
+
+		result := make([]any, 0, len(filtered))
+		for _, item := range filtered {
+			result = append(result, item)
+		}
+
+		return result, nil
+	})
+}
+
+func typedHandlerFunc[T any](sm IStateMachine, handler TypedHandlerFunc[T]) HandlerFuncContext {
+	return func(ctx context.Context, arg any, optArg ...string) (bool, error) {
+		typedObj, err := typedObject[T](sm, arg)
+		if err != nil {
+			return false, err
+		}
+		return handler(ctx, typedObj, optArg...)
+	}
+}
+
+// typedObject converts the object to T. A *T is not dereferenced, the handlers would change a copy of it.
+func typedObject[T any](sm IStateMachine, obj any) (T, error) {
+	if typedObj, ok := obj.(T); ok {
+		return typedObj, nil
+	}
+
+	var zero T
+	return zero, &ErrUnexpectedObject{
+		Machine:  sm.GetName(),
+		Expected: reflect.TypeOf((*T)(nil)).Elem().String(),
+		Got:      fmt.Sprintf("%T", obj),
+	}
+}
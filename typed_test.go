@@ -0,0 +1,65 @@
+package state_machine
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type typedOrder struct {
+	State string
+	Paid  bool
+}
+
+const typedDefinition = `{"name":"orders","states":[
+	{"name":"pending","initial":true,"transitions":[{"name":"paid","on_success":[{"func":"markPaid"}]}]},
+	{"name":"paid","final":true}]}`
+
+func TestTypedMutation(t *testing.T) {
+	sm := NewTyped[*typedOrder]()
+	if err := sm.LoadFromBytes([]byte(typedDefinition), "json"); err != nil {
+		t.Fatal(err)
+	}
+	sm.AddCurrentStateFunction(func(ctx context.Context, order *typedOrder) (string, error) { return order.State, nil })
+	sm.AddExecuteFunction(func(ctx context.Context, nextState string, order *typedOrder) error {
+		order.State = nextState
+		return nil
+	})
+	sm.AddOnSuccessFunction("markPaid", func(ctx context.Context, order *typedOrder, optArg ...string) (bool, error) {
+		order.Paid = true
+		return true, nil
+	})
+
+	order := &typedOrder{State: "pending"}
+	if success, err := sm.ProcessTransition("paid", order); err != nil || !success {
+		t.Fatalf("ProcessTransition = %v, %v, want true, nil", success, err)
+	}
+	if order.State != "paid" || !order.Paid {
+		t.Errorf("order = %+v, want the changes of the handlers", *order)
+	}
+}
+
+func TestTypedObject(t *testing.T) {
+	order := typedOrder{State: "pending"}
+
+	tests := []struct {
+		name    string
+		convert func() (any, error)
+		wantErr bool
+	}{
+		{name: "value", convert: func() (any, error) { return typedObject[typedOrder](NewStateMachine(), order) }},
+		{name: "pointer", convert: func() (any, error) { return typedObject[*typedOrder](NewStateMachine(), &order) }},
+		{name: "pointer to a machine typed on the value", convert: func() (any, error) { return typedObject[typedOrder](NewStateMachine(), &order) }, wantErr: true},
+		{name: "value to a machine typed on the pointer", convert: func() (any, error) { return typedObject[*typedOrder](NewStateMachine(), order) }, wantErr: true},
+		{name: "other type", convert: func() (any, error) { return typedObject[typedOrder](NewStateMachine(), "order-1") }, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := test.convert()
+			if test.wantErr != errors.Is(err, &ErrUnexpectedObject{}) {
+				t.Errorf("typedObject = %v, want ErrUnexpectedObject %v", err, test.wantErr)
+			}
+		})
+	}
+}
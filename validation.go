@@ -0,0 +1,329 @@
+package state_machine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Validation issue kinds
+const (
+	ValidationKindCheck          = "check"
+	ValidationKindOnSuccess      = "on_success"
+	ValidationKindOnError        = "on_error"
+	ValidationKindAdapter        = "adapter"
+	ValidationKindFilter         = "filter"
+	ValidationKindStateMachine   = "state_machine"
+	ValidationKindExecute        = "execute"
+	ValidationKindCurrentState   = "current_state"
+	ValidationKindOnEnter        = "on_enter"
+	ValidationKindOnExit         = "on_exit"
+	ValidationKindBefore         = "before_transition"
+	ValidationKindAfter          = "after_transition"
+	ValidationKindCompensate     = "compensate"
+	ValidationKindParent         = "parent"
+	ValidationKindRegion         = "region"
+	ValidationKindJoin           = "join"
+	ValidationKindTimerStore     = "timer_store"
+	ValidationKindInitial        = "initial"
+	ValidationKindFinal          = "final"
+	validationReasonNotFound     = "is not registered"
+	validationReasonMissingState = "is missing the target state argument"
+	validationReasonNotRevert    = "of a triggered state machine must be " + CompensateRevert
+	validationReasonNotDeclared  = "is not a declared state"
+	validationReasonOtherRegion  = "is not the region of the state"
+	validationReasonNoInitial    = "state is not declared"
+	validationReasonFinal        = "declares transitions"
+)
+
+// ValidationIssue a single problem found while validating a state machine
+type ValidationIssue struct {
+	// State where the reference was found
+	State string `json:"state,omitempty"`
+	// Transition where the reference was found
+	Transition string `json:"transition,omitempty"`
+	// Kind of the reference (check, on_success, ...)
+	Kind string `json:"kind"`
+	// Name of the referenced function
+	Name string `json:"name,omitempty"`
+	// Reason
+	Reason string `json:"reason"`
+}
+
+func (i ValidationIssue) String() string {
+	var location string
+	switch {
+	case i.Transition != "":
+		location = fmt.Sprintf(" in transition [%s] -> [%s]", i.State, i.Transition)
+	case i.State != "":
+		location = fmt.Sprintf(" in state [%s]", i.State)
+	}
+
+	switch {
+	case i.Kind == ValidationKindInitial:
+		return fmt.Sprintf("%s %s", i.Kind, i.Reason)
+	case i.Name == "":
+		return fmt.Sprintf("%s function %s%s", i.Kind, i.Reason, location)
+	}
+
+	return fmt.Sprintf("%s [%s]%s %s", i.Kind, i.Name, location, i.Reason)
+}
+
+// ErrValidation aggregates every issue found while validating a state machine
+type ErrValidation struct {
+	// Machine
+	Machine string
+	// Issues
+	Issues []ValidationIssue
+}
+
+func (e *ErrValidation) Error() string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("state machine [%s] has %d validation issue(s):", e.Machine, len(e.Issues)))
+	for _, issue := range e.Issues {
+		b.WriteString("\n - ")
+		b.WriteString(issue.String())
+	}
+
+	return b.String()
+}
+
+func (e *ErrValidation) Is(target error) bool {
+	_, ok := target.(*ErrValidation)
+	return ok
+}
+
+// Validate checks the definition and cross-checks every handler referenced by it against the registered handlers
+func (sm *StateMachine) Validate() error {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+
+	return sm.validate()
+}
+
+// validate validates the state machine, the caller must hold the lock
+func (sm *StateMachine) validate() error {
+	return sm.validationErr(append(sm.definitionIssues(), sm.registrationIssues()...))
+}
+
+// validateDefinition validates the structure of the definition (parents, regions, joins and final states).
+// The transitions to undeclared states are valid, the states without transitions do not have to be declared,
+// see Analyze to report them. It does not depend on the registered handlers so it runs on load, the caller must hold the lock
+// it does not depend on the registered handlers so it runs on load, the caller must hold the lock
+func (sm *StateMachine) validateDefinition() error {
+	return sm.validationErr(sm.definitionIssues())
+}
+
+func (sm *StateMachine) validationErr(issues []ValidationIssue) error {
+	if len(issues) == 0 {
+		return nil
+	}
+
+	return &ErrValidation{
+		Machine: sm.Name,
+		Issues:  issues,
+	}
+}
+
+// definitionIssues returns the structural issues of the definition
+func (sm *StateMachine) definitionIssues() (issues []ValidationIssue) {
+	// the initial state is optional, but the regions are only entered by the initial transition
+	if sm.initialState == "" && len(sm.regions) > 0 {
+		issues = append(issues, ValidationIssue{Kind: ValidationKindInitial, Reason: validationReasonNoInitial})
+	}
+
+	for _, state := range sortedKeys(sm.finalStates) {
+		if len(sm.MapStates[state]) > 0 {
+			issues = append(issues, ValidationIssue{Kind: ValidationKindFinal, Name: state, Reason: validationReasonFinal})
+		}
+	}
+
+	for _, state := range sortedKeys(sm.parents) {
+		if _, declared := sm.MapStates[sm.parents[state]]; !declared {
+			issues = append(issues, ValidationIssue{State: state, Kind: ValidationKindParent, Name: sm.parents[state], Reason: validationReasonNotDeclared})
+		}
+	}
+
+	for _, state := range sortedKeys(sm.MapStates) {
+		for _, transition := range sortedKeys(sm.MapStates[state]) {
+			issues = append(issues, sm.validateRegions(state, transition, sm.MapStates[state][transition])...)
+		}
+	}
+
+	return issues
+}
+
+// registrationIssues returns the handlers referenced by the definition that are not registered
+func (sm *StateMachine) registrationIssues() (issues []ValidationIssue) {
+	if sm.currentState == nil && sm.stateStore == nil && (sm.stateVector == nil || len(sm.regions) == 0) {
+		issues = append(issues, ValidationIssue{Kind: ValidationKindCurrentState, Reason: validationReasonNotFound})
+	}
+
+	if sm.execute == nil && sm.stateStore == nil && (sm.executeVector == nil || len(sm.regions) == 0) {
+		issues = append(issues, ValidationIssue{Kind: ValidationKindExecute, Reason: validationReasonNotFound})
+	}
+
+	if sm.initialState != "" {
+		issues = append(issues, sm.validateHandlers("", sm.initialState, sm.initialHandlers)...)
+	}
+
+	issues = append(issues, sm.validateOnSuccessHandlers("", "", ValidationKindBefore, sm.BeforeTransition)...)
+	issues = append(issues, sm.validateOnSuccessHandlers("", "", ValidationKindAfter, sm.AfterTransition)...)
+
+	for _, state := range sortedKeys(sm.OnExit) {
+		issues = append(issues, sm.validateOnSuccessHandlers(state, "", ValidationKindOnExit, sm.OnExit[state])...)
+	}
+
+	for _, state := range sortedKeys(sm.OnEnter) {
+		issues = append(issues, sm.validateOnSuccessHandlers(state, "", ValidationKindOnEnter, sm.OnEnter[state])...)
+	}
+
+	for _, state := range sortedKeys(sm.MapStates) {
+		for _, transition := range sortedKeys(sm.MapStates[state]) {
+			issues = append(issues, sm.validateHandlers(state, transition, sm.MapStates[state][transition])...)
+		}
+	}
+
+	return issues
+}
+
+// validateRegions validates that a transition stays in its region and that its join references declared states
+func (sm *StateMachine) validateRegions(state, transition string, handlers Handlers) (issues []ValidationIssue) {
+	if _, declared := sm.MapStates[transition]; declared && sm.stateRegions[transition] != sm.stateRegions[state] {
+		issues = append(issues, ValidationIssue{
+			State:      state,
+			Transition: transition,
+			Kind:       ValidationKindRegion,
+			Name:       sm.stateRegions[transition],
+			Reason:     validationReasonOtherRegion,
+		})
+	}
+
+	for _, region := range sortedKeys(handlers.Join) {
+		joined := handlers.Join[region]
+		if _, declared := sm.MapStates[joined]; !declared || sm.stateRegions[joined] != region {
+			issues = append(issues, ValidationIssue{
+				State:      state,
+				Transition: transition,
+				Kind:       ValidationKindJoin,
+				Name:       region + "=" + joined,
+				Reason:     validationReasonNotDeclared,
+			})
+		}
+	}
+
+	return issues
+}
+
+func (sm *StateMachine) validateHandlers(state, transition string, handlers Handlers) (issues []ValidationIssue) {
+	missing := func(kind, name string) {
+		issues = append(issues, ValidationIssue{
+			State:      state,
+			Transition: transition,
+			Kind:       kind,
+			Name:       name,
+			Reason:     validationReasonNotFound,
+		})
+	}
+
+	var validateChecks func(checks []CheckStruct)
+	validateChecks = func(checks []CheckStruct) {
+		for _, check := range checks {
+			if check.Not != nil {
+				validateChecks([]CheckStruct{*check.Not})
+			}
+			validateChecks(check.All)
+			validateChecks(check.Any)
+
+			if check.Func != "" && sm.checkFunction(check.Func) == nil {
+				missing(ValidationKindCheck, check.Func)
+			}
+		}
+	}
+	validateChecks(handlers.Check)
+
+	if handlers.After > 0 && sm.timerStore == nil {
+		issues = append(issues, ValidationIssue{State: state, Transition: transition, Kind: ValidationKindTimerStore, Reason: validationReasonNotFound})
+	}
+
+	issues = append(issues, sm.validateOnSuccessHandlers(state, transition, ValidationKindOnSuccess, handlers.OnSuccess)...)
+
+	for _, onError := range handlers.OnError {
+		if sm.onErrorFunction(onError.Func) == nil {
+			missing(ValidationKindOnError, onError.Func)
+		}
+	}
+
+	return issues
+}
+
+// validateOnSuccessHandlers validates on_success like handlers (on_success, on_enter, on_exit, ...)
+func (sm *StateMachine) validateOnSuccessHandlers(state, transition, kind string, handlers []OnSuccessStruct) (issues []ValidationIssue) {
+	missing := func(kind, name string) {
+		issues = append(issues, ValidationIssue{
+			State:      state,
+			Transition: transition,
+			Kind:       kind,
+			Name:       name,
+			Reason:     validationReasonNotFound,
+		})
+	}
+
+	for _, onSuccess := range handlers {
+		if onSuccess.Adapter != "" && sm.adapterFunction(onSuccess.Adapter) == nil {
+			missing(ValidationKindAdapter, onSuccess.Adapter)
+		}
+
+		if onSuccess.Filter != "" && sm.filterFunction(onSuccess.Filter) == nil {
+			missing(ValidationKindFilter, onSuccess.Filter)
+		}
+
+		if onSuccess.IsStateMachine {
+			if sm.stateMachinesToTriggerMap[onSuccess.Func] == nil {
+				missing(ValidationKindStateMachine, onSuccess.Func)
+			}
+
+			if len(onSuccess.FuncArg) < 2 {
+				issues = append(issues, ValidationIssue{
+					State:      state,
+					Transition: transition,
+					Kind:       ValidationKindStateMachine,
+					Name:       onSuccess.Func,
+					Reason:     validationReasonMissingState,
+				})
+			}
+
+			if onSuccess.Compensate != "" && onSuccess.Compensate != CompensateRevert {
+				issues = append(issues, ValidationIssue{
+					State:      state,
+					Transition: transition,
+					Kind:       ValidationKindCompensate,
+					Name:       onSuccess.Compensate,
+					Reason:     validationReasonNotRevert,
+				})
+			}
+			continue
+		}
+
+		if sm.onSuccessFunction(onSuccess.Func) == nil {
+			missing(kind, onSuccess.Func)
+		}
+
+		if onSuccess.Compensate != "" && sm.compensateFunction(onSuccess.Compensate) == nil {
+			missing(ValidationKindCompensate, onSuccess.Compensate)
+		}
+	}
+
+	return issues
+}
+
+// sortedKeys returns the keys of the map in a deterministic order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
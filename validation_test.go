@@ -0,0 +1,104 @@
+package state_machine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidationOnLoad(t *testing.T) {
+	tests := []struct {
+		name       string
+		definition string
+		want       string
+	}{
+		{
+			name: "valid definition with unregistered handlers",
+			definition: `{"name":"orders","states":[
+				{"name":"pending","initial":true,"transitions":[{"name":"paid","check":[{"func":"isPaid"}]}]},
+				{"name":"paid","final":true}]}`,
+		},
+		{
+			name: "transition to an undeclared state",
+			definition: `{"name":"orders","states":[
+				{"name":"pending","initial":true,"transitions":[{"name":"shipped"}]}]}`,
+		},
+		{
+			name: "transition to another region",
+			definition: `{"name":"orders","states":[
+				{"name":"open","initial":true,"transitions":[{"name":"paid"}]}],
+				"regions":[{"name":"payment","states":[{"name":"unpaid","initial":true,"transitions":[{"name":"paid"}]},{"name":"paid"}]}]}`,
+			want: "region [payment] in transition [open] -> [paid] is not the region of the state",
+		},
+		{
+			name: "no initial state",
+			definition: `{"name":"orders","states":[
+				{"name":"pending","transitions":[{"name":"paid"}]},
+				{"name":"paid","final":true}]}`,
+		},
+		{
+			name: "regions without an initial state",
+			definition: `{"name":"orders","states":[
+				{"name":"open","transitions":[{"name":"completed"}]},
+				{"name":"completed","final":true}],
+				"regions":[{"name":"payment","states":[{"name":"unpaid","initial":true}]}]}`,
+			want: "initial state is not declared",
+		},
+		{
+			name: "final state with transitions",
+			definition: `{"name":"orders","states":[
+				{"name":"pending","initial":true,"transitions":[{"name":"paid"}]},
+				{"name":"paid","final":true,"transitions":[{"name":"pending"}]}]}`,
+			want: "final [paid] declares transitions",
+		},
+		{
+			name: "undeclared parent",
+			definition: `{"name":"orders","states":[
+				{"name":"pending","initial":true,"parent":"open","transitions":[{"name":"paid"}]},
+				{"name":"paid","final":true}]}`,
+			want: "parent [open] in state [pending] is not a declared state",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sm := NewStateMachine(WithValidation())
+			err := sm.LoadFromBytes([]byte(test.definition), "json")
+			if test.want == "" {
+				if err != nil {
+					t.Fatalf("LoadFromBytes = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, &ErrValidation{}) || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("LoadFromBytes = %v, want an ErrValidation with %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestValidationOnTransition(t *testing.T) {
+	sm := NewStateMachine(WithValidation())
+	if err := sm.LoadFromBytes([]byte(`{"name":"orders","states":[
+		{"name":"pending","initial":true,"transitions":[{"name":"paid","check":[{"func":"isPaid"}]}]},
+		{"name":"paid","final":true}]}`), "json"); err != nil {
+		t.Fatal(err)
+	}
+	sm.AddCurrentStateFunction(func(any) (string, error) { return "pending", nil })
+	sm.AddExecuteFunction(func(string, any) error { return nil })
+
+	_, err := sm.ProcessTransition("paid", struct{}{})
+	if !errors.Is(err, &ErrValidation{}) || !strings.Contains(err.Error(), "check [isPaid] in transition [pending] -> [paid] is not registered") {
+		t.Errorf("ProcessTransition = %v, want an ErrValidation of the unregistered check", err)
+	}
+}
+
+func TestValidationOfTheExamples(t *testing.T) {
+	for _, filePath := range []string{"examples/state-machine-1.json", "examples/state-machine-2.json", "examples/state-machine-3.json"} {
+		t.Run(filePath, func(t *testing.T) {
+			if err := NewStateMachine(WithValidation()).Load(filePath); err != nil {
+				t.Errorf("Load = %v, want nil", err)
+			}
+		})
+	}
+}